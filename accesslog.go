@@ -0,0 +1,146 @@
+package lightmux
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects the line format of AccessLog.
+type AccessLogFormat int
+
+const (
+	// CommonLogFormat is the Apache Common Log Format: host ident user [time] "request" status bytes.
+	CommonLogFormat AccessLogFormat = iota
+	// CombinedLogFormat extends CommonLogFormat with "referer" "user-agent".
+	CombinedLogFormat
+	// JSONLogFormat writes one JSON object per line.
+	JSONLogFormat
+)
+
+// accessLogTime is the timestamp layout of Common and Combined lines.
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogConfig configures the AccessLog middleware.
+type AccessLogConfig struct {
+	// Output receives the lines, default: os.Stdout. Writes are serialized.
+	// Use a RotatingFile to write to rotated files and an AsyncWriter to keep slow disks off the request path.
+	Output io.Writer
+	Format AccessLogFormat
+}
+
+// accessLogEntry is a line of JSONLogFormat.
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	RemoteIP  string  `json:"remote_ip"`
+	User      string  `json:"user,omitempty"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Route     string  `json:"route,omitempty"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Duration  float64 `json:"duration_ms"`
+	RequestID string  `json:"request_id,omitempty"`
+	// Attrs are the attributes added with WithLogAttrs.
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// AccessLog returns a middleware writing one access log line per request in a standard format,
+// for pipelines that ingest Apache style or JSON lines logs. See RequestLogger for log/slog output.
+func AccessLog(cfg AccessLogConfig) Middleware {
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	var mu sync.Mutex
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, _ = withRequestInfo(r)
+			rec := newResponseRecorder(w)
+
+			next(rec, r)
+
+			line := formatAccessLog(cfg.Format, r, rec, start)
+			mu.Lock()
+			cfg.Output.Write(line)
+			mu.Unlock()
+		}
+	}
+}
+
+func formatAccessLog(format AccessLogFormat, r *http.Request, rec *responseRecorder, start time.Time) []byte {
+	user, _, _ := r.BasicAuth()
+
+	if format == JSONLogFormat {
+		line, _ := json.Marshal(accessLogEntry{
+			Time:      start.Format(time.RFC3339),
+			RemoteIP:  ClientIP(r),
+			User:      user,
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Route:     RoutePattern(r),
+			Status:    rec.Status(),
+			Bytes:     rec.bytes,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+			Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			RequestID: RequestID(r),
+			Attrs:     logAttrsMap(LogAttrs(r)),
+		})
+		return append(line, '\n')
+	}
+
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if rec.bytes > 0 {
+		size = strconv.Itoa(rec.bytes)
+	}
+
+	line := make([]byte, 0, 256)
+	line = append(line, ClientIP(r)...)
+	line = append(line, " - "...)
+	line = append(line, user...)
+	line = append(line, " ["...)
+	line = start.AppendFormat(line, accessLogTime)
+	line = append(line, "] "...)
+	line = strconv.AppendQuote(line, r.Method+" "+r.URL.RequestURI()+" "+r.Proto)
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, int64(rec.Status()), 10)
+	line = append(line, ' ')
+	line = append(line, size...)
+	if format == CombinedLogFormat {
+		line = append(line, ' ')
+		line = strconv.AppendQuote(line, r.Referer())
+		line = append(line, ' ')
+		line = strconv.AppendQuote(line, r.UserAgent())
+	}
+	return append(line, '\n')
+}
+
+// logAttrsMap converts attributes to a map for JSON encoding, nil without attributes.
+func logAttrsMap(attrs []slog.Attr) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attrs))
+	for _, attr := range attrs {
+		if v := attr.Value.Resolve(); v.Kind() == slog.KindGroup {
+			m[attr.Key] = logAttrsMap(v.Group())
+		} else {
+			m[attr.Key] = v.Any()
+		}
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package lightmux
+
+import "net/http"
+
+// WrapStd converts standard library style middleware (func(http.Handler) http.Handler) into a Middleware.
+// This is also the signature of chi middlewares, gorilla/mux MiddlewareFunc and gorilla/handlers constructors
+// such as handlers.CORS(...); handlers taking extra arguments can be closed over:
+//
+//	lightmux.WrapStd(func(h http.Handler) http.Handler { return handlers.LoggingHandler(os.Stdout, h) })
+func WrapStd(mw func(http.Handler) http.Handler) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return mw(next).ServeHTTP
+	}
+}
+
+// ToStd converts a Middleware into standard library style middleware, e.g. to reuse it outside LightMux.
+func ToStd(mw Middleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return mw(next.ServeHTTP)
+	}
+}
+
+// UseStd registers standard library style middlewares globally, see Use and WrapStd.
+func (l *LightMux) UseStd(middlewares ...func(http.Handler) http.Handler) {
+	for _, mw := range middlewares {
+		l.Use(WrapStd(mw))
+	}
+}
+
+// NegroniHandler is the negroni middleware interface.
+type NegroniHandler interface {
+	ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+}
+
+// NegroniFunc adapts a negroni style function to NegroniHandler.
+type NegroniFunc func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+
+// ServeHTTP calls f.
+func (f NegroniFunc) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	f(w, r, next)
+}
+
+// WrapNegroni converts negroni middleware (ServeHTTP(w, r, next)) into a Middleware.
+func WrapNegroni(h NegroniHandler) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r, next)
+		}
+	}
+}
+
+// GorillaMiddleware is the gorilla/mux middleware interface, implemented by types with a Middleware method.
+type GorillaMiddleware interface {
+	Middleware(next http.Handler) http.Handler
+}
+
+// WrapGorilla converts a gorilla/mux middleware value into a Middleware.
+func WrapGorilla(m GorillaMiddleware) Middleware {
+	return WrapStd(m.Middleware)
+}
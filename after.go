@@ -0,0 +1,43 @@
+package lightmux
+
+import (
+	"net/http"
+	"time"
+)
+
+// ResponseInfo describes a completed response, see After.
+type ResponseInfo struct {
+	Status   int
+	Bytes    int
+	Duration time.Duration
+	// Route is the matched route pattern, empty if no route matched.
+	Route string
+}
+
+// AfterHook is called once the response has been written.
+type AfterHook func(r *http.Request, res ResponseInfo)
+
+// After registers hooks called after the handler and all middlewares returned, with the captured status,
+// body size and duration. Hooks run in registration order on the request goroutine, so they should be fast;
+// they suit logging, metrics and auditing without every middleware wrapping the ResponseWriter itself.
+// Hooks are only called for requests served by the server handler (see Run), not for probes.
+func (l *LightMux) After(hooks ...AfterHook) {
+	l.afterHooks = append(l.afterHooks, hooks...)
+}
+
+// runWithAfterHooks serves the request through next, then calls the after hooks.
+func (l *LightMux) runWithAfterHooks(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := newResponseRecorder(w)
+	next(rec, r)
+
+	res := ResponseInfo{
+		Status:   rec.Status(),
+		Bytes:    rec.bytes,
+		Duration: time.Since(start),
+		Route:    RoutePattern(r),
+	}
+	for _, hook := range l.afterHooks {
+		hook(r, res)
+	}
+}
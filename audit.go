@@ -0,0 +1,156 @@
+package lightmux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuditRedacted replaces the values of redacted audit parameters.
+const AuditRedacted = "[REDACTED]"
+
+// AuditEntry records who did what, see Audit.
+type AuditEntry struct {
+	Time  time.Time
+	Actor string
+	// Method and Route (pattern) of the request, Path is the raw path.
+	Method string
+	Route  string
+	Path   string
+	// Params holds the path wildcards and query parameters (first value), redacted per AuditConfig.Redact.
+	Params    map[string]string
+	Status    int
+	RequestID string
+	ClientIP  string
+}
+
+// AuditSink stores audit entries, e.g. in a database table or an append-only log.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// AuditSinkFunc adapts a function to the AuditSink interface.
+type AuditSinkFunc func(ctx context.Context, entry AuditEntry) error
+
+// Record implements AuditSink.
+func (f AuditSinkFunc) Record(ctx context.Context, entry AuditEntry) error {
+	return f(ctx, entry)
+}
+
+// AuditConfig configures the Audit middleware.
+type AuditConfig struct {
+	// Sink receives the entries, required.
+	Sink AuditSink
+	// Actor identifies who made the request from the auth context, default: the Basic auth username.
+	Actor func(r *http.Request) string
+	// Methods to audit, default: all.
+	Methods []string
+	// Redact lists parameter names (case-insensitive) whose values are replaced with AuditRedacted,
+	// e.g. "password" or "token".
+	Redact []string
+}
+
+// Audit returns a middleware recording who (Actor) did what (method, route, parameters, status)
+// to cfg.Sink once the handler returned. Sink errors are logged through the Logger of the LightMux
+// (see WithLogger), they don't affect the response.
+// It panics if no sink is configured.
+func Audit(cfg AuditConfig) Middleware {
+	if cfg.Sink == nil {
+		panic("audit sink must not be nil")
+	}
+	if cfg.Actor == nil {
+		cfg.Actor = func(r *http.Request) string {
+			user, _, _ := r.BasicAuth()
+			return user
+		}
+	}
+	redact := make(map[string]bool, len(cfg.Redact))
+	for _, name := range cfg.Redact {
+		redact[strings.ToLower(name)] = true
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if len(cfg.Methods) > 0 && !containsMethod(cfg.Methods, r.Method) {
+				next(w, r)
+				return
+			}
+
+			start := time.Now()
+			r, info := withRequestInfo(r)
+			rec := newResponseRecorder(w)
+			defer func() {
+				// a panicking handler ends as a 500, it is audited before the panic goes on
+				recovered := recover()
+				status := rec.Status()
+				if recovered != nil && !rec.wroteHeader {
+					status = http.StatusInternalServerError
+				}
+				recordAudit(cfg, redact, r, info, start, status)
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+			next(rec, r)
+		}
+	}
+}
+
+// recordAudit builds the entry of a request and hands it to the sink.
+func recordAudit(cfg AuditConfig, redact map[string]bool, r *http.Request, info *requestInfo, start time.Time, status int) {
+	entry := AuditEntry{
+		Time:      start,
+		Actor:     cfg.Actor(r),
+		Method:    r.Method,
+		Route:     RoutePattern(r),
+		Path:      r.URL.Path,
+		Params:    make(map[string]string),
+		Status:    status,
+		RequestID: RequestID(r),
+		ClientIP:  ClientIP(r),
+	}
+	for name, values := range r.URL.Query() {
+		entry.Params[name] = values[0]
+	}
+	if info.routed != nil {
+		for _, name := range patternWildcards(entry.Route) {
+			entry.Params[name] = info.routed.PathValue(name)
+		}
+	}
+	for name := range entry.Params {
+		if redact[strings.ToLower(name)] {
+			entry.Params[name] = AuditRedacted
+		}
+	}
+
+	// the entry must be stored even if the client left or a timeout expired the request context
+	if err := cfg.Sink.Record(context.WithoutCancel(r.Context()), entry); err != nil {
+		requestLogger(r).Error("audit sink", "error", err)
+	}
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternWildcards returns the wildcard names of a route pattern, e.g. ["id"] for "/users/{id}".
+func patternWildcards(pattern string) []string {
+	var names []string
+	for _, segment := range strings.Split(pattern, "/") {
+		name, ok := strings.CutPrefix(segment, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "}"), "...")
+		if name != "" && name != "$" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+package lightmux
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"slices"
+)
+
+// CertManager obtains and renews TLS certificates automatically, e.g. *autocert.Manager
+// from golang.org/x/crypto/acme/autocert configured with HostPolicy and a DirCache.
+type CertManager interface {
+	// GetCertificate returns the certificate for the requested server name, answering TLS-ALPN-01 challenges.
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	// HTTPHandler answers HTTP-01 challenges and passes other requests to fallback.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// RunAutoCert starts the server with TLS certificates obtained and renewed by m.
+// HTTP-01 challenges are registered as a route, so global middlewares (logging, metrics) observe them,
+// and are answered on the plain HTTP listener of RedirectHTTP (":http" by default), which redirects
+// everything else to HTTPS. TLS-ALPN-01 challenges are answered on the TLS listener.
+func (l *LightMux) RunAutoCert(ctx context.Context, m CertManager) error {
+	challenge := m.HTTPHandler(http.NotFoundHandler())
+	l.NewRoute(acmeChallengePrefix+"{token}").Handle(http.MethodGet, challenge.ServeHTTP)
+
+	if l.httpsRedirect == nil {
+		l.RedirectHTTP(HTTPSRedirectConfig{})
+	}
+	l.httpsRedirect.ACMEHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.server.Handler.ServeHTTP(w, r)
+	})
+
+	cfg := &tls.Config{}
+	if l.server.TLSConfig != nil {
+		cfg = l.server.TLSConfig.Clone()
+	}
+	cfg.GetCertificate = m.GetCertificate
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+	if !slices.Contains(cfg.NextProtos, acmeTLSALPNProto) {
+		cfg.NextProtos = append(cfg.NextProtos, acmeTLSALPNProto)
+	}
+
+	return l.RunTLSConfig(ctx, cfg)
+}
+
+// acmeTLSALPNProto is the ALPN protocol of ACME TLS-ALPN-01 challenges.
+const acmeTLSALPNProto = "acme-tls/1"
@@ -0,0 +1,75 @@
+package lightmux
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// BuildInfo describes the running build, see EnableVersionEndpoint.
+type BuildInfo struct {
+	Version   string `json:"version,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	// StartTime is set by the endpoint to when the server started.
+	StartTime time.Time `json:"start_time"`
+}
+
+// ReadBuildInfo returns the build info embedded by the Go toolchain: the main module version,
+// the VCS revision (with a "-dirty" suffix for modified trees), the VCS commit time and the Go version.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	modified := false
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if modified && info.Commit != "" {
+		info.Commit += "-dirty"
+	}
+	return info
+}
+
+// EnableVersionEndpoint serves the build version, commit, Go version and server start time as JSON on path
+// (e.g. "/version"). Empty fields of info are filled from ReadBuildInfo, so versions set with -ldflags take
+// precedence. The endpoint is protected by the admin guard if set, middlewares run after it.
+func (l *LightMux) EnableVersionEndpoint(path string, info BuildInfo, middlewares ...Middleware) {
+	defaults := ReadBuildInfo()
+	if info.Version == "" {
+		info.Version = defaults.Version
+	}
+	if info.Commit == "" {
+		info.Commit = defaults.Commit
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = defaults.BuildTime
+	}
+	if info.GoVersion == "" {
+		info.GoVersion = defaults.GoVersion
+	}
+
+	l.adminRoute(path, middlewares...).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		info := info
+		if started := l.startedAt.Load(); started != 0 {
+			info.StartTime = time.Unix(0, started).UTC()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+}
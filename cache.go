@@ -0,0 +1,280 @@
+package lightmux
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response stored by ResponseCache.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Expires time.Time
+}
+
+// CacheStore stores cached responses. Keys start with the request path followed by a NUL byte,
+// which lets DeletePrefix invalidate all variants of a path.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+	DeletePrefix(prefix string)
+}
+
+// CacheConfig configures a ResponseCache.
+type CacheConfig struct {
+	// TTL of cached responses, used when Cache is called with zero TTL. Default: 1 minute.
+	TTL time.Duration
+	// Store keeps the responses, default: NewMemoryCacheStore(10000).
+	Store CacheStore
+	// VaryHeaders are request headers included in the cache key (e.g. Accept-Language).
+	VaryHeaders []string
+	// MaxBodySize of cacheable responses, larger ones are not cached. Default: 1 MiB.
+	MaxBodySize int
+}
+
+// ResponseCache is an in-process response cache for hot read-only endpoints.
+// GET and HEAD responses with status 200 are cached by method, path, query, VaryHeaders and the request
+// headers named in the response Vary header; responses setting cookies, Vary: * or Cache-Control
+// no-store/private are never cached. Only the headers set by the cached handler are replayed, headers
+// of outer middlewares (request ID, CORS, cookies) are set per request.
+type ResponseCache struct {
+	cfg CacheConfig
+}
+
+// NewResponseCache creates a ResponseCache, apply it to routes with Cache.
+func NewResponseCache(cfg CacheConfig) *ResponseCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryCacheStore(10000)
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+	return &ResponseCache{cfg: cfg}
+}
+
+// Cache returns a middleware caching responses for ttl, zero uses the configured TTL.
+// Cached responses are served without running the handler and carry X-Cache: HIT.
+func (c *ResponseCache) Cache(ttl time.Duration) Middleware {
+	if ttl <= 0 {
+		ttl = c.cfg.TTL
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next(w, r)
+				return
+			}
+
+			key := c.key(r)
+			cached, ok := c.cfg.Store.Get(key)
+			if ok && cached.Status == 0 {
+				// the entry only records the Vary header of the responses of key
+				cached, ok = c.cfg.Store.Get(varyKey(key, cached.Header["Vary"], r))
+			}
+			if ok {
+				h := w.Header()
+				for name, values := range cached.Header {
+					h[name] = slices.Clone(values)
+				}
+				h.Set("X-Cache", "HIT")
+				w.WriteHeader(cached.Status)
+				w.Write(cached.Body)
+				return
+			}
+
+			// headers set by outer middlewares (request ID, CORS, cookies) belong to this request only
+			before := w.Header().Clone()
+			w.Header().Set("X-Cache", "MISS")
+			cw := &cacheWriter{responseRecorder: newResponseRecorder(w), limit: c.cfg.MaxBodySize}
+			next(cw, r)
+
+			header := handlerHeaders(before, w.Header())
+			if !cw.cacheable(header) {
+				return
+			}
+			expires := time.Now().Add(ttl)
+			if vary := varyHeaders(header); len(vary) > 0 {
+				c.cfg.Store.Set(key, &CachedResponse{Header: http.Header{"Vary": vary}, Expires: expires})
+				key = varyKey(key, vary, r)
+			}
+			c.cfg.Store.Set(key, &CachedResponse{
+				Status:  cw.Status(),
+				Header:  header,
+				Body:    cw.buf.Bytes(),
+				Expires: expires,
+			})
+		}
+	}
+}
+
+// handlerHeaders returns the response headers set or changed by the handler, given the headers before it ran.
+func handlerHeaders(before, after http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range after {
+		if name != "X-Cache" && !slices.Equal(before[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	return header
+}
+
+// varyHeaders returns the request header names listed in the Vary response header.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// varyKey extends key with the request values of the Vary headers.
+func varyKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteByte(0)
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// Invalidate removes all cached variants of path.
+func (c *ResponseCache) Invalidate(path string) {
+	c.cfg.Store.DeletePrefix(path + "\x00")
+}
+
+// InvalidatePrefix removes all cached responses whose path starts with prefix.
+func (c *ResponseCache) InvalidatePrefix(prefix string) {
+	c.cfg.Store.DeletePrefix(prefix)
+}
+
+func (c *ResponseCache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	b.WriteByte(0)
+	b.WriteString(r.Method)
+	b.WriteByte(0)
+	b.WriteString(r.URL.RawQuery)
+	for _, name := range c.cfg.VaryHeaders {
+		b.WriteByte(0)
+		b.WriteString(r.Header.Get(name))
+	}
+	return b.String()
+}
+
+// cacheWriter records the response and keeps a copy of the body while it stays below limit.
+type cacheWriter struct {
+	*responseRecorder
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if !cw.overflow {
+		if cw.buf.Len()+len(p) > cw.limit {
+			cw.overflow = true
+			cw.buf.Reset()
+		} else {
+			cw.buf.Write(p)
+		}
+	}
+	return cw.responseRecorder.Write(p)
+}
+
+// cacheable reports whether the response with the handler headers may be cached.
+func (cw *cacheWriter) cacheable(header http.Header) bool {
+	if cw.overflow || cw.Status() != http.StatusOK {
+		return false
+	}
+	if len(header["Set-Cookie"]) > 0 || slices.Contains(varyHeaders(header), "*") {
+		return false
+	}
+	cc := strings.ToLower(cw.Header().Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// MemoryCacheStore is an in-process CacheStore holding at most maxEntries responses.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	entries    map[string]*CachedResponse
+	maxEntries int
+}
+
+// NewMemoryCacheStore creates a MemoryCacheStore. When full, expired entries are evicted first,
+// then arbitrary ones.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries:    make(map[string]*CachedResponse),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get implements CacheStore.
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(resp.Expires) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return resp, true
+}
+
+// Set implements CacheStore.
+func (s *MemoryCacheStore) Set(key string, resp *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[key]; !exists && len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[key] = resp
+}
+
+// DeletePrefix implements CacheStore.
+func (s *MemoryCacheStore) DeletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryCacheStore) evict() {
+	now := time.Now()
+	for key, resp := range s.entries {
+		if now.After(resp.Expires) {
+			delete(s.entries, key)
+		}
+	}
+	for key := range s.entries {
+		if len(s.entries) < s.maxEntries {
+			return
+		}
+		delete(s.entries, key)
+	}
+}
@@ -0,0 +1,58 @@
+package lightmux
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RequestPredicate reports whether a request matches a condition, see Only and Unless.
+type RequestPredicate func(r *http.Request) bool
+
+// Only returns a middleware applying mw to requests matching pred; other requests skip it.
+func Only(pred RequestPredicate, mw Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		wrapped := mw(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if pred(r) {
+				wrapped(w, r)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// Unless returns a middleware applying mw to requests not matching pred,
+// e.g. a global auth middleware skipping health checks and static assets:
+//
+//	lmux.Use(lightmux.Unless(lightmux.PathPrefix("/healthz", "/static/"), auth))
+func Unless(pred RequestPredicate, mw Middleware) Middleware {
+	return Only(func(r *http.Request) bool { return !pred(r) }, mw)
+}
+
+// PathPrefix matches requests whose URL path starts with one of the prefixes.
+func PathPrefix(prefixes ...string) RequestPredicate {
+	return func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PathIs matches requests whose URL path equals one of the paths.
+func PathIs(paths ...string) RequestPredicate {
+	return func(r *http.Request) bool {
+		return slices.Contains(paths, r.URL.Path)
+	}
+}
+
+// MethodIs matches requests with one of the methods.
+func MethodIs(methods ...string) RequestPredicate {
+	return func(r *http.Request) bool {
+		return slices.Contains(methods, r.Method)
+	}
+}
@@ -0,0 +1,134 @@
+package lightmux
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config holds deployment settings loaded with ConfigFromEnv or ConfigFromFile, see Options.
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	// TLSCertFile and TLSKeyFile are meant for RunTLS, see TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// LogLevel of the application (debug, info, warn, error), e.g. for RequestLogger.
+	// Other levels than info log LightMux messages to stderr with a slog text handler at that level.
+	LogLevel slog.Level
+}
+
+// configKeys maps the keys of config files (and, upper-cased with the LIGHTMUX_ prefix, environment variables)
+// to the Config fields.
+var configKeys = []string{
+	"addr", "read_timeout", "read_header_timeout", "write_timeout", "idle_timeout",
+	"shutdown_timeout", "tls_cert_file", "tls_key_file", "log_level",
+}
+
+// ConfigFromEnv loads the Config from LIGHTMUX_ADDR, LIGHTMUX_READ_TIMEOUT, LIGHTMUX_READ_HEADER_TIMEOUT,
+// LIGHTMUX_WRITE_TIMEOUT, LIGHTMUX_IDLE_TIMEOUT, LIGHTMUX_SHUTDOWN_TIMEOUT, LIGHTMUX_TLS_CERT_FILE,
+// LIGHTMUX_TLS_KEY_FILE and LIGHTMUX_LOG_LEVEL. Durations use time.ParseDuration syntax ("30s").
+// Unset variables leave the field zero.
+func ConfigFromEnv() (Config, error) {
+	values := make(map[string]string)
+	for _, key := range configKeys {
+		if value, ok := os.LookupEnv("LIGHTMUX_" + strings.ToUpper(key)); ok {
+			values[key] = value
+		}
+	}
+	return parseConfig(values)
+}
+
+// ConfigFromFile loads the Config from a JSON file with the keys addr, read_timeout, read_header_timeout,
+// write_timeout, idle_timeout, shutdown_timeout, tls_cert_file, tls_key_file and log_level,
+// e.g. {"addr": ":8080", "read_timeout": "30s"}. Unknown keys are rejected.
+func ConfigFromFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return Config{}, fmt.Errorf("lightmux: config file %s: %w", path, err)
+	}
+	for key := range values {
+		if !slices.Contains(configKeys, key) {
+			return Config{}, fmt.Errorf("lightmux: config file %s: unknown key %q", path, key)
+		}
+	}
+	return parseConfig(values)
+}
+
+func parseConfig(values map[string]string) (Config, error) {
+	cfg := Config{
+		Addr:        values["addr"],
+		TLSCertFile: values["tls_cert_file"],
+		TLSKeyFile:  values["tls_key_file"],
+	}
+
+	durations := map[string]*time.Duration{
+		"read_timeout":        &cfg.ReadTimeout,
+		"read_header_timeout": &cfg.ReadHeaderTimeout,
+		"write_timeout":       &cfg.WriteTimeout,
+		"idle_timeout":        &cfg.IdleTimeout,
+		"shutdown_timeout":    &cfg.ShutdownTimeout,
+	}
+	for key, field := range durations {
+		value, ok := values[key]
+		if !ok || value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("lightmux: config %s: %w", key, err)
+		}
+		*field = d
+	}
+
+	if level, ok := values["log_level"]; ok && level != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(level)); err != nil {
+			return Config{}, fmt.Errorf("lightmux: config log_level: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// Options converts the Config into options for New. Zero fields produce no option.
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.Addr != "" {
+		opts = append(opts, WithAddr(c.Addr))
+	}
+	if c.ReadTimeout > 0 {
+		opts = append(opts, WithReadTimeout(c.ReadTimeout))
+	}
+	if c.ReadHeaderTimeout > 0 {
+		opts = append(opts, WithReadHeaderTimeout(c.ReadHeaderTimeout))
+	}
+	if c.WriteTimeout > 0 {
+		opts = append(opts, WithWriteTimeout(c.WriteTimeout))
+	}
+	if c.IdleTimeout > 0 {
+		opts = append(opts, WithIdleTimeout(c.IdleTimeout))
+	}
+	if c.ShutdownTimeout > 0 {
+		opts = append(opts, WithShutdownTimeout(c.ShutdownTimeout))
+	}
+	if c.LogLevel != slog.LevelInfo {
+		opts = append(opts, WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: c.LogLevel}))))
+	}
+	return opts
+}
+
+// TLS reports whether certificate files are configured, i.e. RunTLS should be used instead of Run.
+func (c Config) TLS() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
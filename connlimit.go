@@ -0,0 +1,90 @@
+package lightmux
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnLimitConfig configures the connection limit, see LimitConnections.
+type ConnLimitConfig struct {
+	// Max simultaneous open connections across all listeners.
+	Max int
+	// QueueTimeout is how long an accepted connection waits for a free slot before it is closed.
+	// While it waits, no other connection is accepted and new ones queue in the kernel backlog. Zero closes immediately.
+	QueueTimeout time.Duration
+	// OnReject is called with the peer address of every connection closed for exceeding the limit.
+	OnReject func(addr net.Addr)
+}
+
+// ConnLimitStats reports the state of the connection limit.
+type ConnLimitStats struct {
+	Active   int
+	Rejected uint64
+}
+
+// LimitConnections caps the simultaneous open connections (including hijacked ones such as WebSockets),
+// giving backpressure at the TCP layer before a goroutine is spawned per connection. It panics if cfg.Max < 1.
+func (l *LightMux) LimitConnections(cfg ConnLimitConfig) {
+	if cfg.Max < 1 {
+		panic("connection limit must be positive")
+	}
+	l.connLimit = &connLimiter{cfg: cfg, slots: make(chan struct{}, cfg.Max)}
+}
+
+// ConnLimitStats returns the active and rejected connection counts of LimitConnections.
+func (l *LightMux) ConnLimitStats() ConnLimitStats {
+	if l.connLimit == nil {
+		return ConnLimitStats{}
+	}
+	return ConnLimitStats{Active: len(l.connLimit.slots), Rejected: l.connLimit.rejected.Load()}
+}
+
+type connLimiter struct {
+	cfg      ConnLimitConfig
+	slots    chan struct{}
+	rejected atomic.Uint64
+}
+
+// acquire reserves a slot for c, closing it if none frees up within the queue timeout.
+func (cl *connLimiter) acquire(c net.Conn) (net.Conn, bool) {
+	select {
+	case cl.slots <- struct{}{}:
+		return &limitedConn{Conn: c, release: cl.release}, true
+	default:
+	}
+
+	if cl.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(cl.cfg.QueueTimeout)
+		defer timer.Stop()
+		select {
+		case cl.slots <- struct{}{}:
+			return &limitedConn{Conn: c, release: cl.release}, true
+		case <-timer.C:
+		}
+	}
+
+	cl.rejected.Add(1)
+	if cl.cfg.OnReject != nil {
+		cl.cfg.OnReject(c.RemoteAddr())
+	}
+	c.Close()
+	return nil, false
+}
+
+func (cl *connLimiter) release() {
+	<-cl.slots
+}
+
+// limitedConn frees its slot when closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
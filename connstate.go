@@ -0,0 +1,92 @@
+package lightmux
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnStats reports the connections of the running server, see LightMux.ConnStats.
+type ConnStats struct {
+	// New, Active and Idle are the connections currently in each http.ConnState.
+	New    int
+	Active int
+	Idle   int
+	// Accepted, Hijacked and Closed count connections since the server started.
+	Accepted uint64
+	Hijacked uint64
+	Closed   uint64
+}
+
+// connTracker keeps the state of every open connection for ConnStats and the ConnState hooks.
+type connTracker struct {
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+	stats  ConnStats
+	hooks  []func(c net.Conn, state http.ConnState)
+}
+
+// OnConnState registers a hook called on every connection state change of all listeners,
+// in addition to http.Server.ConnState. Hooks run on the connection goroutine and must be fast.
+func (l *LightMux) OnConnState(hook func(c net.Conn, state http.ConnState)) {
+	l.conns.hooks = append(l.conns.hooks, hook)
+}
+
+// ConnStats returns the current connection gauges and counters, e.g. to watch connection churn.
+func (l *LightMux) ConnStats() ConnStats {
+	l.conns.mu.Lock()
+	defer l.conns.mu.Unlock()
+	return l.conns.stats
+}
+
+// trackConnState chains the connection tracking into the server ConnState callback.
+func (l *LightMux) trackConnState() {
+	original := l.server.ConnState
+	l.server.ConnState = func(c net.Conn, state http.ConnState) {
+		l.conns.update(c, state)
+		for _, hook := range l.conns.hooks {
+			hook(c, state)
+		}
+		if original != nil {
+			original(c, state)
+		}
+	}
+}
+
+func (t *connTracker) update(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.states == nil {
+		t.states = make(map[net.Conn]http.ConnState)
+	}
+	if previous, ok := t.states[c]; ok {
+		t.gauge(previous, -1)
+	}
+
+	switch state {
+	case http.StateNew:
+		t.stats.Accepted++
+	case http.StateHijacked:
+		t.stats.Hijacked++
+	case http.StateClosed:
+		t.stats.Closed++
+	}
+	if state == http.StateHijacked || state == http.StateClosed {
+		delete(t.states, c)
+		return
+	}
+	t.states[c] = state
+	t.gauge(state, 1)
+}
+
+func (t *connTracker) gauge(state http.ConnState, delta int) {
+	switch state {
+	case http.StateNew:
+		t.stats.New += delta
+	case http.StateActive:
+		t.stats.Active += delta
+	case http.StateIdle:
+		t.stats.Idle += delta
+	}
+}
@@ -0,0 +1,60 @@
+package lightmux
+
+import "net/http"
+
+// DefaultContentType returns a middleware setting the Content-Type of responses whose handler did not set one,
+// instead of letting net/http sniff it from the body (which e.g. turns JSON into text/plain).
+// Responses without a body (1xx, 204, 304) are left untouched.
+func DefaultContentType(contentType string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(&contentTypeWriter{ResponseWriter: w, contentType: contentType}, r)
+		}
+	}
+}
+
+// DefaultContentType sets the Content-Type used by routes created in the group afterwards
+// when handlers write bodies without setting one, e.g. application/json for an /api group.
+func (g *RouteGroup) DefaultContentType(contentType string) {
+	g.Use(DefaultContentType(contentType))
+}
+
+// contentTypeWriter sets a default Content-Type when the header is written.
+type contentTypeWriter struct {
+	http.ResponseWriter
+	contentType string
+	wroteHeader bool
+}
+
+func (cw *contentTypeWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		bodyAllowed := status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+		if h := cw.Header(); bodyAllowed && h.Get("Content-Type") == "" {
+			h.Set("Content-Type", cw.contentType)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *contentTypeWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer supports it.
+func (cw *contentTypeWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *contentTypeWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
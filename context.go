@@ -0,0 +1,49 @@
+package lightmux
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+type requestInfoCtxKey struct{}
+
+// requestInfo is shared request state filled in by LightMux while the request travels
+// through middlewares and the dispatcher, so outer middlewares can observe what happened inside.
+type requestInfo struct {
+	mux   *LightMux
+	route *Route
+	// routed is the request as dispatched to the route, carrying its path values.
+	routed    *http.Request
+	requestID string
+	trace     *TraceContext
+	clientIP  string
+
+	// logAttrs are added with WithLogAttrs, possibly from handler goroutines.
+	logMu    sync.Mutex
+	logAttrs []slog.Attr
+}
+
+// withRequestInfo returns the request info stored in r, attaching a new one if r has none.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		return r, info
+	}
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoCtxKey{}, info)), info
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoCtxKey{}).(*requestInfo)
+	return info
+}
+
+// RoutePattern returns the path of the LightMux route that matched the request (e.g. "/users/{id}").
+// Outer middlewares can call it after the handler returned. It is empty if no route matched.
+func RoutePattern(r *http.Request) string {
+	if info := requestInfoFrom(r.Context()); info != nil && info.route != nil {
+		return info.route.Path
+	}
+	return r.Pattern
+}
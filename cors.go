@@ -0,0 +1,170 @@
+package lightmux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins lists allowed origins. "*" allows any origin and
+	// entries like "https://*.example.com" allow any subdomain.
+	AllowedOrigins []string
+	// AllowOriginFunc is an optional custom check, used when AllowedOrigins do not match.
+	AllowOriginFunc func(origin string) bool
+	// AllowedMethods answered to preflight requests, default: GET, HEAD, POST, PUT, PATCH, DELETE.
+	AllowedMethods []string
+	// AllowedHeaders answered to preflight requests, default: the requested headers are reflected.
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers readable by the browser.
+	ExposedHeaders []string
+	// AllowCredentials sets Access-Control-Allow-Credentials.
+	AllowCredentials bool
+	// MaxAge sets Access-Control-Max-Age of preflight responses, zero omits the header.
+	MaxAge time.Duration
+	// PassthroughPreflight passes preflight requests to the next handler instead of answering them with 204.
+	PassthroughPreflight bool
+	// RouteMethods answers preflights with the methods registered on the matched route instead of AllowedMethods,
+	// so browsers cache exact results and never preflight methods the route does not serve.
+	RouteMethods bool
+}
+
+// RouteCORS tunes CORS preflight responses of a single route, see Route.CORS.
+type RouteCORS struct {
+	// MaxAge overrides CORSConfig.MaxAge, e.g. a long cache for hot endpoints. Browsers cap it (Chrome: 2 hours).
+	MaxAge time.Duration
+	// AllowedHeaders overrides CORSConfig.AllowedHeaders.
+	AllowedHeaders []string
+}
+
+// CORS tunes the preflight responses of the CORS middleware (global, group or route) for this route.
+func (r *Route) CORS(opts RouteCORS) {
+	r.cors = &opts
+}
+
+// preflightRoute returns the route a preflight request targets, nil if unknown.
+// Global middlewares run before the dispatcher, so the route is looked up in the mux when it is not set yet.
+func preflightRoute(r *http.Request) *Route {
+	info := requestInfoFrom(r.Context())
+	if info == nil {
+		return nil
+	}
+	if info.route != nil {
+		return info.route
+	}
+	if info.mux == nil {
+		return nil
+	}
+	_, pattern := info.mux.mux.Handler(r)
+	return info.mux.routeMap[pattern]
+}
+
+// CORS returns a middleware applying the Cross-Origin Resource Sharing policy described by cfg.
+// It can be used globally with LightMux.Use or per group/route: routes without an OPTIONS handler
+// answer OPTIONS through their middlewares, so preflights also work for GET/POST-only routes.
+func CORS(cfg CORSConfig) Middleware {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete,
+		}
+	}
+
+	allowAny := false
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+	}
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := ""
+	if cfg.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !(allowAny || cfg.originAllowed(origin)) {
+				if preflight && !cfg.PassthroughPreflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next(w, r)
+				return
+			}
+
+			if allowAny && !cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next(w, r)
+				return
+			}
+
+			methods, headers, maxAge := methods, headers, maxAge
+			if route := preflightRoute(r); route != nil {
+				if cfg.RouteMethods {
+					methods = allowedMethodsJoin(route.Methods)
+				}
+				if route.cors != nil {
+					if route.cors.MaxAge > 0 {
+						maxAge = strconv.Itoa(int(route.cors.MaxAge / time.Second))
+					}
+					if len(route.cors.AllowedHeaders) > 0 {
+						headers = strings.Join(route.cors.AllowedHeaders, ", ")
+					}
+				}
+			}
+
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+
+			if cfg.PassthroughPreflight {
+				next(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// originAllowed reports whether origin matches AllowedOrigins or AllowOriginFunc.
+func (cfg *CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return cfg.AllowOriginFunc != nil && cfg.AllowOriginFunc(origin)
+}
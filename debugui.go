@@ -0,0 +1,149 @@
+package lightmux
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// debugUIErrors is the number of recent errors shown by the debug UI.
+const debugUIErrors = 20
+
+// debugError is an error reported through Error or ReportError, see EnableDebugUI.
+type debugError struct {
+	Time   time.Time
+	Method string
+	Path   string
+	Status int
+	Error  string
+}
+
+// debugErrors keeps the most recent errors in a ring.
+type debugErrors struct {
+	mu     sync.Mutex
+	errors [debugUIErrors]debugError
+	next   int
+	count  int
+}
+
+func (d *debugErrors) record(r *http.Request, status int, err error) {
+	e := debugError{Time: time.Now(), Method: r.Method, Path: r.URL.Path, Status: status}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	d.errors[d.next] = e
+	d.next = (d.next + 1) % debugUIErrors
+	d.count = min(d.count+1, debugUIErrors)
+	d.mu.Unlock()
+}
+
+// recent returns the recorded errors, newest first.
+func (d *debugErrors) recent() []debugError {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	recent := make([]debugError, 0, d.count)
+	for i := 1; i <= d.count; i++ {
+		recent = append(recent, d.errors[(d.next-i+debugUIErrors)%debugUIErrors])
+	}
+	return recent
+}
+
+// EnableDebugUI serves an HTML page on path (e.g. "/_lightmux") with the route table, the middleware chain
+// of every route, recent errors reported through Error and live stats (see EnableStats, which it turns on).
+// It is meant for development; the page is protected by the admin guard if set, middlewares run after it.
+// It must be called before Run.
+func (l *LightMux) EnableDebugUI(path string, middlewares ...Middleware) {
+	l.EnableStats()
+
+	errs := &debugErrors{}
+	l.OnError(errs.record)
+
+	l.adminRoute(path, middlewares...).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		l.serveDebugUI(w, errs)
+	})
+}
+
+type debugUIRoute struct {
+	Path    string
+	Methods []string
+	Chains  []*RouteExplanation
+	Stats   RouteStats
+}
+
+func (l *LightMux) serveDebugUI(w http.ResponseWriter, errs *debugErrors) {
+	stats := make(map[string]RouteStats)
+	for _, s := range l.RouteStats() {
+		stats[s.Route] = s
+	}
+
+	routes := make([]debugUIRoute, 0, len(l.routeMap))
+	for _, route := range l.routeMap {
+		dr := debugUIRoute{Path: route.Path, Stats: stats[route.Path]}
+		for method := range route.Methods {
+			dr.Methods = append(dr.Methods, method)
+		}
+		sort.Strings(dr.Methods)
+		for _, method := range dr.Methods {
+			dr.Chains = append(dr.Chains, l.explain(route, route.Path, method))
+		}
+		routes = append(routes, dr)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+
+	var uptime time.Duration
+	if started := l.startedAt.Load(); started != 0 {
+		uptime = time.Since(time.Unix(0, started)).Round(time.Second)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugUITemplate.Execute(w, map[string]any{
+		"Uptime":   uptime,
+		"InFlight": len(l.InFlight()),
+		"Conns":    l.ConnStats(),
+		"Draining": l.Draining(),
+		"Routes":   routes,
+		"Errors":   errs.recent(),
+	})
+}
+
+var debugUITemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>LightMux</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+ol { margin: 0; padding-left: 1.5em; }
+.skipped { text-decoration: line-through; color: #999; }
+</style>
+</head>
+<body>
+<h1>LightMux</h1>
+<p>Uptime: {{.Uptime}} &middot; In flight: {{.InFlight}} &middot; Connections: {{.Conns.Active}} active, {{.Conns.Idle}} idle{{if .Draining}} &middot; <strong>draining</strong>{{end}}</p>
+
+<h2>Routes</h2>
+<table>
+<tr><th>Route</th><th>Middleware chains</th><th>Requests</th><th>2xx</th><th>4xx</th><th>5xx</th><th>Last hit</th></tr>
+{{range .Routes}}<tr>
+<td>{{.Path}}</td>
+<td>{{range .Chains}}<strong>{{.Method}}</strong><ol>{{range .Chain}}<li{{if .Skipped}} class="skipped"{{end}}>[{{.Source}}] {{.Func}}{{if .Name}} ({{.Name}}){{end}}</li>{{end}}</ol>{{end}}</td>
+<td>{{.Stats.Total}}</td><td>{{.Stats.Status2xx}}</td><td>{{.Stats.Status4xx}}</td><td>{{.Stats.Status5xx}}</td>
+<td>{{if not .Stats.LastHit.IsZero}}{{.Stats.LastHit.Format "15:04:05"}}{{else}}never{{end}}</td>
+</tr>{{end}}
+</table>
+
+<h2>Recent errors</h2>
+{{if .Errors}}<table>
+<tr><th>Time</th><th>Request</th><th>Status</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.Method}} {{.Path}}</td><td>{{.Status}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,148 @@
+package lightmux
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultMaxDecompressedSize limits decompressed request bodies when DecompressConfig.MaxSize is not set.
+const DefaultMaxDecompressedSize = 10 << 20
+
+// EncodingIdentity is the Content-Encoding of uncompressed request bodies.
+const EncodingIdentity = "identity"
+
+// ErrUnsupportedEncoding is passed to Error when a request body has a content coding that is not accepted.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+type contentEncodingCtxKey struct{}
+
+// DecompressConfig configures the Decompress middleware.
+type DecompressConfig struct {
+	// MaxSize limits the decompressed body size, default: DefaultMaxDecompressedSize. Negative means unlimited.
+	MaxSize int64
+}
+
+// Decompress returns a middleware decoding gzip and deflate request bodies, so handlers always read plain bodies.
+// Other content codings are answered with 415 Unsupported Media Type and ErrUnsupportedEncoding through Error.
+// Bodies are decoded lazily, so routes declaring accepted encodings (see Route.AcceptEncodings)
+// reject requests before anything is decompressed, even when Decompress is registered globally.
+func Decompress(cfg DecompressConfig) Middleware {
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultMaxDecompressedSize
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// the header is removed once decoded, so nested Decompress middlewares pass through
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == EncodingIdentity {
+				next(w, r)
+				return
+			}
+
+			if encoding != "gzip" && encoding != "deflate" {
+				unsupportedEncoding(w, r, []string{EncodingIdentity, "gzip", "deflate"})
+				return
+			}
+
+			body := io.ReadCloser(&lazyDecoder{body: r.Body, encoding: encoding})
+			if cfg.MaxSize > 0 {
+				body = http.MaxBytesReader(w, body, cfg.MaxSize)
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), contentEncodingCtxKey{}, encoding))
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+
+			next(w, r)
+		}
+	}
+}
+
+// AcceptEncodings declares the request Content-Encodings the route accepts, e.g. EncodingIdentity only
+// for signature-verified webhooks. Requests with other encodings are answered with 415 before any middleware
+// of the route runs. Routes without declared encodings accept everything.
+func (r *Route) AcceptEncodings(encodings ...string) {
+	r.encodings = normalizeEncodings(encodings)
+}
+
+// AcceptEncodings declares the request Content-Encodings accepted by routes created in the group afterwards,
+// see Route.AcceptEncodings.
+func (g *RouteGroup) AcceptEncodings(encodings ...string) {
+	g.encodings = normalizeEncodings(encodings)
+}
+
+// encodingAllowed reports whether the request Content-Encoding is accepted by the route.
+func (r *Route) encodingAllowed(req *http.Request) bool {
+	return len(r.encodings) == 0 || slices.Contains(r.encodings, requestContentEncoding(req))
+}
+
+// requestContentEncoding returns the Content-Encoding of the request, before Decompress removed it.
+// Requests without Content-Encoding are reported as identity.
+func requestContentEncoding(r *http.Request) string {
+	if encoding, ok := r.Context().Value(contentEncodingCtxKey{}).(string); ok {
+		return encoding
+	}
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" {
+		return EncodingIdentity
+	}
+	return encoding
+}
+
+// unsupportedEncoding writes a 415 response advertising the accepted encodings (RFC 7694).
+func unsupportedEncoding(w http.ResponseWriter, r *http.Request, accepted []string) {
+	w.Header().Set("Accept-Encoding", strings.Join(accepted, ", "))
+	Error(w, r, http.StatusUnsupportedMediaType, ErrUnsupportedEncoding)
+}
+
+func normalizeEncodings(encodings []string) []string {
+	normalized := make([]string, 0, len(encodings))
+	for _, encoding := range encodings {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(encoding)))
+	}
+	return normalized
+}
+
+// lazyDecoder creates the decompressing reader on the first Read.
+type lazyDecoder struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.Reader
+}
+
+func (d *lazyDecoder) Read(p []byte) (int, error) {
+	if d.reader == nil {
+		switch d.encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(d.body)
+			if err != nil {
+				return 0, err
+			}
+			d.reader = zr
+		default:
+			// the deflate content-coding is the zlib format (RFC 9110 section 8.4.1.2)
+			zr, err := zlib.NewReader(d.body)
+			if err != nil {
+				return 0, err
+			}
+			d.reader = zr
+		}
+	}
+	return d.reader.Read(p)
+}
+
+func (d *lazyDecoder) Close() error {
+	if closer, ok := d.reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return d.body.Close()
+}
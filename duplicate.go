@@ -0,0 +1,20 @@
+package lightmux
+
+// DuplicateRoutes selects what happens when a path or a method of a path is registered twice.
+type DuplicateRoutes int
+
+const (
+	// PanicOnDuplicate panics on duplicate registrations (default), catching copy-paste mistakes early.
+	PanicOnDuplicate DuplicateRoutes = iota
+	// ReplaceDuplicates lets the last registration win and logs a warning, for routes generated
+	// from config or plugins that may be registered again.
+	// NewRoute on an existing path returns the existing route with its middlewares replaced,
+	// Handle on an existing method replaces the handler.
+	ReplaceDuplicates
+)
+
+// SetDuplicateRoutes selects how duplicate registrations are handled for routes created afterwards.
+// Registrations only take effect until ApplyRoutes (called by Run).
+func (l *LightMux) SetDuplicateRoutes(mode DuplicateRoutes) {
+	l.duplicates = mode
+}
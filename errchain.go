@@ -0,0 +1,76 @@
+package lightmux
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorHandlerFunc is a handler returning an error instead of writing it, see HandleE.
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ErrorMiddleware wraps an ErrorHandlerFunc, e.g. to check permissions and return an error instead of
+// writing a response and having to remember to return.
+type ErrorMiddleware func(ErrorHandlerFunc) ErrorHandlerFunc
+
+// HTTPError is an error carrying the status code of the response, see StatusError.
+type HTTPError struct {
+	Status int
+	Err    error
+}
+
+// StatusError returns an error answered with status by error-returning handlers.
+// Messages of errors with a status below 500 are sent to the client by the default error encoder.
+func StatusError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Status)
+	}
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorStatus returns the status of the first HTTPError in err's chain, 500 if there is none.
+func ErrorStatus(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status != 0 {
+		return httpErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// ChainE wraps handler with middlewares (the first one outermost) and converts it into an http.HandlerFunc.
+// Returned errors are written through Error with the status from ErrorStatus, so the central
+// error encoder and OnError hooks apply. If the handler already wrote the response,
+// the error is only reported through ReportError.
+func ChainE(handler ErrorHandlerFunc, middlewares ...ErrorMiddleware) http.HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		err := handler(rec, r)
+		if err == nil {
+			return
+		}
+
+		status := ErrorStatus(err)
+		if rec.wroteHeader {
+			ReportError(r, status, err)
+			return
+		}
+		Error(w, r, status, err)
+	}
+}
+
+// HandleE registers an error-returning handler for method, wrapped with error-returning middlewares,
+// see ChainE. Regular route middlewares still apply around it.
+func (r *Route) HandleE(method string, handler ErrorHandlerFunc, middlewares ...ErrorMiddleware) {
+	r.Handle(method, ChainE(handler, middlewares...))
+}
@@ -0,0 +1,113 @@
+package lightmux
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrorRateConfig configures an error-rate watchdog, see OnErrorRate.
+type ErrorRateConfig struct {
+	// Threshold is the fraction of 5xx responses triggering the alert, e.g. 0.05. Default: 0.1.
+	Threshold float64
+	// Window of the sliding error rate, default: 1 minute.
+	Window time.Duration
+	// MinRequests in the window before alerting, avoiding alerts on sparse traffic. Default: 20.
+	MinRequests int64
+	// Routes to watch by pattern, default: all routes.
+	Routes []string
+}
+
+// ErrorRateAlert reports a route crossing its error-rate threshold, see OnErrorRate.
+type ErrorRateAlert struct {
+	Route string
+	// Total and Errors are the requests and 5xx responses in the window.
+	Total  int64
+	Errors int64
+	Rate   float64
+	// Recovered is set when the rate dropped back below the threshold after an alert.
+	Recovered bool
+}
+
+// OnErrorRate starts a watchdog tracking the 5xx rate of every route over a sliding window. hook is called
+// once when the rate of a route crosses cfg.Threshold and again with Recovered set when it drops back below,
+// enabling in-process alerting or auto-mitigation (e.g. opening a circuit breaker). Hooks run on the request
+// goroutine that crossed the threshold. It must be called before Run.
+func (l *LightMux) OnErrorRate(cfg ErrorRateConfig, hook func(alert ErrorRateAlert)) {
+	if cfg.Threshold <= 0 || cfg.Threshold >= 1 {
+		cfg.Threshold = 0.1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	l.errorWatchdogs = append(l.errorWatchdogs, &errorWatchdog{cfg: cfg, hook: hook})
+}
+
+type errorWatchdog struct {
+	cfg  ErrorRateConfig
+	hook func(alert ErrorRateAlert)
+}
+
+// errorRateTracker keeps the sliding window of a route in a ring of buckets.
+type errorRateTracker struct {
+	mu       sync.Mutex
+	route    string
+	watchdog *errorWatchdog
+	width    time.Duration
+	buckets  [sloBuckets]sloBucket
+	alerting bool
+}
+
+// newObserver returns the observer of route, nil if the watchdog does not watch it.
+func (w *errorWatchdog) newObserver(route string) routeObserver {
+	if len(w.cfg.Routes) > 0 && !slices.Contains(w.cfg.Routes, route) {
+		return nil
+	}
+	t := &errorRateTracker{route: route, watchdog: w, width: w.cfg.Window / sloBuckets}
+	if t.width <= 0 {
+		t.width = 1
+	}
+	return t.observe
+}
+
+func (t *errorRateTracker) observe(m RequestMetric) {
+	now := time.Now().UnixNano() / int64(t.width)
+	cfg := t.watchdog.cfg
+
+	t.mu.Lock()
+	b := &t.buckets[now%sloBuckets]
+	if b.epoch != now {
+		*b = sloBucket{epoch: now}
+	}
+	b.total++
+	if m.Status >= 500 {
+		b.bad++
+	}
+
+	alert := ErrorRateAlert{Route: t.route}
+	for _, b := range t.buckets {
+		if b.epoch > now-sloBuckets && b.epoch <= now {
+			alert.Total += b.total
+			alert.Errors += b.bad
+		}
+	}
+	alert.Rate = float64(alert.Errors) / float64(alert.Total)
+
+	alerting := t.alerting
+	if alert.Total >= cfg.MinRequests && alert.Rate > cfg.Threshold {
+		alerting = true
+	} else if alert.Rate <= cfg.Threshold {
+		alerting = false
+	}
+	fire := alerting != t.alerting
+	t.alerting = alerting
+	t.mu.Unlock()
+
+	if fire {
+		alert.Recovered = !alerting
+		t.watchdog.hook(alert)
+	}
+}
@@ -0,0 +1,53 @@
+package lightmux
+
+import (
+	"net/http"
+)
+
+// ErrorEncoder writes an error response with the given status code.
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// SetErrorEncoder replaces the central error encoder used by Error, default writes {"error": "..."} JSON bodies.
+func (l *LightMux) SetErrorEncoder(encoder ErrorEncoder) {
+	l.errorEncoder = encoder
+}
+
+// OnError registers a hook called for every error reported through Error or ReportError,
+// e.g. to forward errors to a tracker. Hooks are called in registration order.
+func (l *LightMux) OnError(hook func(r *http.Request, status int, err error)) {
+	l.errorHooks = append(l.errorHooks, hook)
+}
+
+// Error reports err through the OnError hooks of the LightMux serving r
+// and writes the error response with its central ErrorEncoder.
+// Outside of LightMux, or without a custom encoder, a JSON error is written;
+// messages of 5xx errors are replaced with the status text to avoid leaking internals.
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	ReportError(r, status, err)
+
+	if info := requestInfoFrom(r.Context()); info != nil && info.mux != nil && info.mux.errorEncoder != nil {
+		info.mux.errorEncoder(w, r, status, err)
+		return
+	}
+	defaultErrorEncoder(w, r, status, err)
+}
+
+// ReportError calls the OnError hooks of the LightMux serving r without writing a response.
+// It is meant for errors occurring after the response has been partially written.
+func ReportError(r *http.Request, status int, err error) {
+	info := requestInfoFrom(r.Context())
+	if info == nil || info.mux == nil {
+		return
+	}
+	for _, hook := range info.mux.errorHooks {
+		hook(r, status, err)
+	}
+}
+
+func defaultErrorEncoder(w http.ResponseWriter, r *http.Request, status int, err error) {
+	msg := http.StatusText(status)
+	if status < 500 && err != nil {
+		msg = err.Error()
+	}
+	writeJSONError(w, status, msg)
+}
@@ -0,0 +1,80 @@
+package lightmux
+
+import (
+	"net/http"
+	"time"
+)
+
+// RouterEventKind is the kind of a dispatch decision, see OnRouterEvent.
+type RouterEventKind int
+
+const (
+	// EventRouteMatched is emitted when a route and method matched, before the handler runs.
+	EventRouteMatched RouterEventKind = iota
+	// EventNotFound is emitted when no route matched the path, or the method with RespondNotFound.
+	EventNotFound
+	// EventMethodNotAllowed is emitted when the path matched a route, but not the method.
+	EventMethodNotAllowed
+	// EventHandlerCompleted is emitted after the route handler and its middlewares returned.
+	EventHandlerCompleted
+)
+
+// String returns the name of the event kind.
+func (k RouterEventKind) String() string {
+	switch k {
+	case EventRouteMatched:
+		return "route-matched"
+	case EventNotFound:
+		return "not-found"
+	case EventMethodNotAllowed:
+		return "method-not-allowed"
+	case EventHandlerCompleted:
+		return "handler-completed"
+	default:
+		return "unknown"
+	}
+}
+
+// RouterEvent describes a dispatch decision of the router.
+type RouterEvent struct {
+	Kind    RouterEventKind
+	Request *http.Request
+	// Route is the matched route pattern, empty for EventNotFound.
+	Route string
+	// Status and Duration of the handler, set for EventHandlerCompleted only.
+	Status   int
+	Duration time.Duration
+}
+
+// OnRouterEvent subscribes hook to the dispatch decisions of the router, so audit systems and custom metrics
+// can observe them without wrapping every handler. Hooks run in registration order on the request goroutine,
+// so they should be fast. It must be called before Run.
+func (l *LightMux) OnRouterEvent(hook func(e RouterEvent)) {
+	l.routerHooks = append(l.routerHooks, hook)
+}
+
+func (l *LightMux) emit(e RouterEvent) {
+	for _, hook := range l.routerHooks {
+		hook(e)
+	}
+}
+
+// serveRouteHandler serves a matched route, emitting the matched and completed events if subscribed.
+func (l *LightMux) serveRouteHandler(handler http.Handler, route *Route, w http.ResponseWriter, r *http.Request) {
+	if len(l.routerHooks) == 0 {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	l.emit(RouterEvent{Kind: EventRouteMatched, Request: r, Route: route.Path})
+	start := time.Now()
+	rec := newResponseRecorder(w)
+	handler.ServeHTTP(rec, r)
+	l.emit(RouterEvent{Kind: EventHandlerCompleted, Request: r, Route: route.Path, Status: rec.Status(), Duration: time.Since(start)})
+}
+
+// serveNotFound answers an unknown path, emitting the not-found event if subscribed.
+func (l *LightMux) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	l.emit(RouterEvent{Kind: EventNotFound, Request: r})
+	l.notFoundHandler()(w, r)
+}
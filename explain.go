@@ -0,0 +1,113 @@
+package lightmux
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ChainLink is one step of a request chain, see ExplainRoute.
+type ChainLink struct {
+	// Source is where the step was registered: "global", "named", "group <prefix>", "route" or "handler".
+	Source string
+	// Name is the middleware name given to UseNamed, empty for unnamed middlewares.
+	Name string
+	// Func is the name of the function implementing the step.
+	Func string
+	// Skipped reports a named middleware the route opted out of with Skip; it does not run.
+	Skipped bool
+}
+
+// RouteExplanation is the ordered chain a request runs through, outermost first.
+type RouteExplanation struct {
+	Method string
+	Path   string
+	// Pattern is the route path that matched Path.
+	Pattern string
+	Chain   []ChainLink
+}
+
+// ExplainRoute returns the exact ordered chain (global middlewares, named middlewares, group middlewares,
+// route middlewares and handler) a request with the given method and path runs through,
+// to debug middlewares that do not run. Path may be a concrete request path such as "/users/42".
+func (l *LightMux) ExplainRoute(path, method string) (*RouteExplanation, error) {
+	route := l.matchRoute(path)
+	if route == nil {
+		return nil, fmt.Errorf("no route matches %s", path)
+	}
+
+	if _, ok := route.Methods[method]; !ok && method != http.MethodOptions {
+		return nil, fmt.Errorf("route %s has no %s handler, allowed methods: [%s]", route.Path, method, allowedMethodsJoin(route.Methods))
+	}
+	return l.explain(route, path, method), nil
+}
+
+// explain builds the chain of route for method, which must be registered or OPTIONS.
+func (l *LightMux) explain(route *Route, path, method string) *RouteExplanation {
+	handler, ok := route.Methods[method]
+	e := &RouteExplanation{Method: method, Path: path, Pattern: route.Path}
+	for _, mw := range l.orderedGlobalMiddlewares() {
+		e.Chain = append(e.Chain, ChainLink{Source: "global", Func: getFuncName(mw)})
+	}
+	for _, named := range l.namedMiddlewares {
+		e.Chain = append(e.Chain, ChainLink{Source: "named", Name: named.name, Func: getFuncName(named.middleware), Skipped: route.skip[named.name]})
+	}
+	for i, mw := range route.Middlewares {
+		link := ChainLink{Source: "route", Func: getFuncName(mw)}
+		if i < route.inherited {
+			link.Source = "group " + route.groupPrefix
+		}
+		if i < len(route.middlewareNames) && route.middlewareNames[i] != "" {
+			link.Name = route.middlewareNames[i]
+			link.Skipped = route.skip[link.Name]
+		}
+		e.Chain = append(e.Chain, link)
+	}
+
+	if ok {
+		e.Chain = append(e.Chain, ChainLink{Source: "handler", Func: getFuncName(handler)})
+	} else {
+		e.Chain = append(e.Chain, ChainLink{Source: "handler", Func: "automatic OPTIONS response"})
+	}
+	return e
+}
+
+// String formats the chain one step per line.
+func (e *RouteExplanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s (route %s)\n", e.Method, e.Path, e.Pattern)
+	for i, link := range e.Chain {
+		fmt.Fprintf(&b, "\t%d: [%s] %s", i+1, link.Source, link.Func)
+		if link.Name != "" {
+			fmt.Fprintf(&b, " (%s)", link.Name)
+		}
+		if link.Skipped {
+			b.WriteString(" - skipped")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Print prints the chain to standard output.
+func (e *RouteExplanation) Print() {
+	fmt.Print(e.String())
+}
+
+// matchRoute returns the route whose pattern matches path, using the same matching rules as the mux.
+func (l *LightMux) matchRoute(path string) *Route {
+	if route, ok := l.routeMap[path]; ok {
+		return route
+	}
+
+	mux := http.NewServeMux()
+	for pattern := range l.routeMap {
+		mux.HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+	}
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil
+	}
+	_, pattern := mux.Handler(req)
+	return l.routeMap[pattern]
+}
@@ -0,0 +1,83 @@
+package lightmux
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// expvarServers holds the servers reported by the "lightmux" expvar, keyed by address.
+var expvarServers struct {
+	once   sync.Once
+	mu     sync.Mutex
+	byAddr map[string]*LightMux
+}
+
+// EnableExpvar serves the expvar variables on path (e.g. "/debug/vars") and publishes the router stats
+// under the "lightmux" variable, keyed by server address: uptime, and per route its middleware chain length
+// and request counters by method and status class (see EnableStats, which it turns on).
+// The endpoint is protected by the admin guard if set, middlewares run after it. It must be called before Run.
+func (l *LightMux) EnableExpvar(path string, middlewares ...Middleware) {
+	l.EnableStats()
+
+	expvarServers.once.Do(func() {
+		expvarServers.byAddr = make(map[string]*LightMux)
+		expvar.Publish("lightmux", expvar.Func(expvarSnapshot))
+	})
+	expvarServers.mu.Lock()
+	expvarServers.byAddr[l.server.Addr] = l
+	expvarServers.mu.Unlock()
+
+	l.adminRoute(path, middlewares...).Handle(http.MethodGet, expvar.Handler().ServeHTTP)
+}
+
+// expvarRoute is the expvar representation of a route.
+type expvarRoute struct {
+	Middlewares int                         `json:"middlewares"`
+	Requests    map[string]map[string]int64 `json:"requests"`
+}
+
+func expvarSnapshot() any {
+	expvarServers.mu.Lock()
+	defer expvarServers.mu.Unlock()
+
+	servers := make(map[string]any, len(expvarServers.byAddr))
+	for addr, l := range expvarServers.byAddr {
+		servers[addr] = l.expvarStats()
+	}
+	return servers
+}
+
+// expvarStats returns the uptime and route stats of l.
+func (l *LightMux) expvarStats() map[string]any {
+	var uptime float64
+	if started := l.startedAt.Load(); started != 0 {
+		uptime = time.Since(time.Unix(0, started)).Seconds()
+	}
+
+	routes := make(map[string]*expvarRoute, len(l.routeMap))
+	for path, route := range l.routeMap {
+		routes[path] = &expvarRoute{
+			Middlewares: len(l.globalMiddlewareStack) + route.chainLength(l.namedMiddlewares),
+			Requests:    make(map[string]map[string]int64),
+		}
+	}
+	for _, s := range l.Stats() {
+		if r, ok := routes[s.Route]; ok {
+			r.Requests[s.Method] = map[string]int64{
+				"total": s.Total,
+				"1xx":   s.Status1xx,
+				"2xx":   s.Status2xx,
+				"3xx":   s.Status3xx,
+				"4xx":   s.Status4xx,
+				"5xx":   s.Status5xx,
+			}
+		}
+	}
+
+	return map[string]any{
+		"uptime_seconds": uptime,
+		"routes":         routes,
+	}
+}
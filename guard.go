@@ -0,0 +1,127 @@
+package lightmux
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var (
+	// ErrAccessDenied is passed to Error when a request is rejected with 403.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrAuthRequired is passed to Error when a request lacks valid credentials.
+	ErrAuthRequired = errors.New("authentication required")
+)
+
+// GuardConfig restricts access to sensitive endpoints such as /metrics and admin mounts.
+// All configured checks must pass; an empty config allows everything.
+type GuardConfig struct {
+	// AllowedCIDRs lists client networks allowed to connect, e.g. "10.0.0.0/8" or "127.0.0.1/32".
+	AllowedCIDRs []string
+	// Username and Password enable HTTP Basic authentication.
+	Username string
+	Password string
+	// BearerToken enables "Authorization: Bearer <token>" authentication.
+	// When both Basic credentials and a token are set, either one is accepted.
+	BearerToken string
+	// Authorize is an optional custom check run after the built-in ones.
+	Authorize func(r *http.Request) bool
+}
+
+// Guard returns a middleware enforcing cfg: requests from other networks get 403 with ErrAccessDenied,
+// requests without valid credentials get 401 with ErrAuthRequired, both written through Error.
+// It panics on invalid CIDRs.
+func Guard(cfg GuardConfig) Middleware {
+	prefixes := make([]netip.Prefix, 0, len(cfg.AllowedCIDRs))
+	for _, cidr := range cfg.AllowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid guard CIDR %q: %v", cidr, err))
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	basic := cfg.Username != "" || cfg.Password != ""
+	bearer := cfg.BearerToken != ""
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if len(prefixes) > 0 && !ipAllowed(ClientIP(r), prefixes) {
+				Error(w, r, http.StatusForbidden, ErrAccessDenied)
+				return
+			}
+
+			if basic || bearer {
+				ok := false
+				if user, pass, hasBasic := r.BasicAuth(); basic && hasBasic {
+					ok = secureEqual(user, cfg.Username) && secureEqual(pass, cfg.Password)
+				}
+				if token, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); bearer && hasBearer && !ok {
+					ok = secureEqual(token, cfg.BearerToken)
+				}
+				if !ok {
+					if basic {
+						w.Header().Set("WWW-Authenticate", `Basic realm="restricted"`)
+					} else {
+						w.Header().Set("WWW-Authenticate", "Bearer")
+					}
+					Error(w, r, http.StatusUnauthorized, ErrAuthRequired)
+					return
+				}
+			}
+
+			if cfg.Authorize != nil && !cfg.Authorize(r) {
+				Error(w, r, http.StatusForbidden, ErrAccessDenied)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// SetAdminGuard protects the built-in operational endpoints (metrics, profiling, debug, status and version mounts)
+// with a Guard built from cfg, whether they are registered before or after it; ApplyRoutes attaches the guard.
+// Middlewares passed to those mounts run after the guard.
+func (l *LightMux) SetAdminGuard(cfg GuardConfig) {
+	l.adminGuard = Guard(cfg)
+}
+
+// adminRoute creates a route for a built-in operational endpoint, protected by the admin guard if set.
+func (l *LightMux) adminRoute(path string, middlewares ...Middleware) *Route {
+	route := l.NewRoute(path, middlewares...)
+	route.admin = true
+	return route
+}
+
+// applyAdminGuard puts the admin guard in front of the middlewares of an admin route.
+func (l *LightMux) applyAdminGuard(route *Route) {
+	if !route.admin || route.guarded || l.adminGuard == nil {
+		return
+	}
+	route.Middlewares = append([]Middleware{l.adminGuard}, route.Middlewares...)
+	route.middlewareNames = append([]string{""}, route.middlewareNames...)
+	route.guarded = true
+}
+
+func ipAllowed(ip string, prefixes []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureEqual compares secrets in constant time.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
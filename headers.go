@@ -0,0 +1,93 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrTooManyHeaderFields is passed to Error when a request exceeds HeaderLimitsConfig.MaxFields.
+	ErrTooManyHeaderFields = errors.New("too many request header fields")
+	// ErrHeadersTooLarge is passed to Error when a request exceeds HeaderLimitsConfig.MaxTotalBytes.
+	ErrHeadersTooLarge = errors.New("request header fields too large")
+	// ErrHeaderFieldTooLarge is passed to Error, wrapped with the field name,
+	// when a request exceeds HeaderLimitsConfig.MaxFieldBytes.
+	ErrHeaderFieldTooLarge = errors.New("request header field too large")
+)
+
+type headerStatsCtxKey struct{}
+
+// HeaderStats describes the request headers, see RequestHeaderStats.
+type HeaderStats struct {
+	// Count is the number of header fields, counting repeated fields once per value.
+	Count int
+	// Bytes is the size of the header block as sent on the wire ("Name: value\r\n" per field).
+	Bytes int
+	// LargestField is the name of the largest field and LargestBytes its size.
+	LargestField string
+	LargestBytes int
+}
+
+// HeaderLimitsConfig configures the HeaderLimits middleware. Zero values disable a limit.
+type HeaderLimitsConfig struct {
+	// MaxFieldBytes limits the size of a single header field.
+	MaxFieldBytes int
+	// MaxTotalBytes limits the size of all header fields.
+	MaxTotalBytes int
+	// MaxFields limits the number of header fields.
+	MaxFields int
+	// OnMeasure is an optional hook receiving the stats of every request, e.g. to feed metrics.
+	OnMeasure func(r *http.Request, stats HeaderStats)
+}
+
+// HeaderLimits returns a middleware measuring the request headers, available through RequestHeaderStats,
+// and answering requests exceeding the configured limits with 431 Request Header Fields Too Large through Error.
+// Header names are already canonicalized by net/http, so repeated fields with differing case count as one name.
+// Unlike http.Server.MaxHeaderBytes, limits can differ per route or group.
+func HeaderLimits(cfg HeaderLimitsConfig) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			stats := measureHeaders(r.Header)
+			if cfg.OnMeasure != nil {
+				cfg.OnMeasure(r, stats)
+			}
+
+			switch {
+			case cfg.MaxFields > 0 && stats.Count > cfg.MaxFields:
+				Error(w, r, http.StatusRequestHeaderFieldsTooLarge, ErrTooManyHeaderFields)
+				return
+			case cfg.MaxTotalBytes > 0 && stats.Bytes > cfg.MaxTotalBytes:
+				Error(w, r, http.StatusRequestHeaderFieldsTooLarge, ErrHeadersTooLarge)
+				return
+			case cfg.MaxFieldBytes > 0 && stats.LargestBytes > cfg.MaxFieldBytes:
+				Error(w, r, http.StatusRequestHeaderFieldsTooLarge, fmt.Errorf("%w: %s", ErrHeaderFieldTooLarge, stats.LargestField))
+				return
+			}
+
+			next(w, r.WithContext(context.WithValue(r.Context(), headerStatsCtxKey{}, stats)))
+		}
+	}
+}
+
+// RequestHeaderStats returns the header stats measured by HeaderLimits, ok is false if it was not applied.
+func RequestHeaderStats(r *http.Request) (HeaderStats, bool) {
+	stats, ok := r.Context().Value(headerStatsCtxKey{}).(HeaderStats)
+	return stats, ok
+}
+
+func measureHeaders(h http.Header) HeaderStats {
+	var stats HeaderStats
+	for name, values := range h {
+		for _, value := range values {
+			size := len(name) + len(": ") + len(value) + len("\r\n")
+			stats.Count++
+			stats.Bytes += size
+			if size > stats.LargestBytes {
+				stats.LargestField, stats.LargestBytes = name, size
+			}
+		}
+	}
+	return stats
+}
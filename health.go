@@ -0,0 +1,265 @@
+package lightmux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout bounds each health check run by the readiness endpoint.
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthChecker checks a dependency of the service, e.g. a database ping, cache connectivity or free disk space.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckerFunc adapts a function to HealthChecker.
+type HealthCheckerFunc func(ctx context.Context) error
+
+// Check implements HealthChecker.
+func (f HealthCheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthStatus is the overall state reported by the readiness endpoint, also the severity of a failing check.
+type HealthStatus string
+
+const (
+	// HealthUp means all checks pass.
+	HealthUp HealthStatus = "up"
+	// HealthDegraded means only non-critical checks fail; readiness still answers 200.
+	HealthDegraded HealthStatus = "degraded"
+	// HealthDown means a critical check fails or the server is draining; readiness answers 503.
+	HealthDown HealthStatus = "down"
+)
+
+// HealthCheckConfig configures a health check, see AddHealthCheckWithConfig.
+type HealthCheckConfig struct {
+	// Timeout bounds each run of the check, default: DefaultHealthCheckTimeout.
+	Timeout time.Duration
+	// Interval runs the check in the background while the server runs and serves the cached result,
+	// so probes don't hammer the dependency. Zero runs the check on every readiness probe.
+	Interval time.Duration
+	// Severity is the status caused by a failure of the check: HealthDown (default) or HealthDegraded.
+	Severity HealthStatus
+}
+
+// HealthCheckResult is the result of a single health check.
+type HealthCheckResult struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Severity HealthStatus  `json:"severity"`
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// CheckedAt is when the check last ran, older than the report for interval checks.
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+}
+
+// HealthReport is the aggregated result of all health checks, served as JSON by the readiness endpoint.
+type HealthReport struct {
+	// Healthy is false while draining or when a check with severity HealthDown fails.
+	Healthy  bool                `json:"healthy"`
+	Status   HealthStatus        `json:"status"`
+	Draining bool                `json:"draining"`
+	Checks   []HealthCheckResult `json:"checks"`
+}
+
+type healthCheck struct {
+	name    string
+	checker HealthChecker
+	cfg     HealthCheckConfig
+
+	// mu guards the last result of interval checks.
+	mu     sync.Mutex
+	result *HealthCheckResult
+}
+
+// run runs the check within its timeout.
+func (c *healthCheck) run(ctx context.Context) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	result := HealthCheckResult{
+		Name:      c.name,
+		Healthy:   err == nil,
+		Severity:  c.cfg.Severity,
+		Duration:  time.Since(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// refresh runs the check and caches its result.
+func (c *healthCheck) refresh(ctx context.Context) HealthCheckResult {
+	result := c.run(ctx)
+	c.mu.Lock()
+	c.result = &result
+	c.mu.Unlock()
+	return result
+}
+
+// current returns the cached result of an interval check, running it if there is none yet or it is stale,
+// or runs the check if it has no interval. Results are stale after Interval plus Timeout, which leaves the
+// background refresh time to finish, so probes only run interval checks when it is not running
+// (e.g. Health called without Run, or a check added after start).
+func (c *healthCheck) current(ctx context.Context) HealthCheckResult {
+	if c.cfg.Interval <= 0 {
+		return c.run(ctx)
+	}
+	c.mu.Lock()
+	result := c.result
+	c.mu.Unlock()
+	if result != nil && time.Since(result.CheckedAt) < c.cfg.Interval+c.cfg.Timeout {
+		return *result
+	}
+	return c.refresh(ctx)
+}
+
+// AddHealthCheck registers a named health check. Once checks are registered, the readiness endpoint of
+// EnableHealthEndpoints runs all of them concurrently (each within DefaultHealthCheckTimeout) and answers
+// with the HealthReport as JSON: 200 if all pass, 503 otherwise. Errors and timings are left out of the
+// response unless SetHealthDetails is enabled. It panics if the name is already registered.
+func (l *LightMux) AddHealthCheck(name string, checker HealthChecker) {
+	l.AddHealthCheckWithConfig(name, checker, HealthCheckConfig{})
+}
+
+// AddHealthCheckWithConfig registers a named health check with its own timeout, severity and interval.
+// Interval checks run in the background between start and shutdown of the server; failing HealthDegraded
+// checks report the status "degraded" without failing readiness. It panics if the name is already registered
+// or the severity is unknown.
+func (l *LightMux) AddHealthCheckWithConfig(name string, checker HealthChecker, cfg HealthCheckConfig) {
+	for _, check := range l.healthChecks {
+		if check.name == name {
+			panic("duplicate health check name: " + name)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultHealthCheckTimeout
+	}
+	switch cfg.Severity {
+	case "":
+		cfg.Severity = HealthDown
+	case HealthDown, HealthDegraded:
+	default:
+		panic("invalid health check severity: " + string(cfg.Severity))
+	}
+
+	check := &healthCheck{name: name, checker: checker, cfg: cfg}
+	if cfg.Interval > 0 {
+		l.watchHealthCheck(check)
+	}
+	l.healthChecks = append(l.healthChecks, check)
+}
+
+// watchHealthCheck refreshes the result of an interval check in the background while the server runs.
+func (l *LightMux) watchHealthCheck(check *healthCheck) {
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+	l.onStart(func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			ticker := time.NewTicker(check.cfg.Interval)
+			defer ticker.Stop()
+			for {
+				check.refresh(ctx)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	})
+	l.onStop(func(ctx context.Context) error {
+		if cancel == nil {
+			return nil
+		}
+		cancel()
+		cancel = nil
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// Health returns the aggregated report of all health checks, running per-probe checks concurrently and
+// using the cached results of interval checks. The report is down while the server is draining.
+func (l *LightMux) Health(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Draining: l.Draining(),
+		Checks:   make([]HealthCheckResult, len(l.healthChecks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range l.healthChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = check.current(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report.Status = HealthUp
+	for _, result := range report.Checks {
+		if result.Healthy {
+			continue
+		}
+		if result.Severity != HealthDegraded {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	if report.Draining {
+		report.Status = HealthDown
+	}
+	report.Healthy = report.Status != HealthDown
+	return report
+}
+
+// SetHealthDetails includes the error, duration and time of every check in readiness responses.
+// They are left out by default, as errors may contain hostnames or DSNs and probes are unauthenticated.
+// Health always returns the full report.
+func (l *LightMux) SetHealthDetails(expose bool) {
+	l.healthDetails = expose
+}
+
+// serveHealthReport answers readiness probes with the HealthReport when health checks are registered.
+func (l *LightMux) serveHealthReport(w http.ResponseWriter, r *http.Request) {
+	report := l.Health(r.Context())
+	if !l.healthDetails {
+		for i, check := range report.Checks {
+			report.Checks[i] = HealthCheckResult{Name: check.Name, Healthy: check.Healthy, Severity: check.Severity}
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h["Cache-Control"] = probeNoStore
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(report)
+	}
+}
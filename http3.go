@@ -0,0 +1,61 @@
+package lightmux
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTP3Server serves HTTP/3 over QUIC, e.g. *http3.Server from github.com/quic-go/quic-go/http3.
+type HTTP3Server interface {
+	ListenAndServe() error
+	Shutdown(ctx context.Context) error
+}
+
+// HTTP3Config configures the HTTP/3 listener, see EnableHTTP3.
+type HTTP3Config struct {
+	// NewServer creates the HTTP/3 server serving handler, e.g.
+	//	func(h http.Handler) lightmux.HTTP3Server {
+	//		return &http3.Server{Addr: ":443", Handler: h, TLSConfig: http3.ConfigureTLSConfig(tlsConfig)}
+	//	}
+	NewServer func(handler http.Handler) HTTP3Server
+	// Port advertised in the Alt-Svc header, default: "443".
+	Port string
+	// MaxAge of the Alt-Svc advertisement, default: 24 hours.
+	MaxAge time.Duration
+}
+
+// EnableHTTP3 makes Run and RunTLS also serve the routes over HTTP/3 and advertise it with Alt-Svc
+// on TLS responses, so clients upgrade to QUIC while TCP listeners remain for fallback.
+// The HTTP/3 server starts and shuts down with the other listeners. It panics if cfg.NewServer is nil.
+func (l *LightMux) EnableHTTP3(cfg HTTP3Config) {
+	if cfg.NewServer == nil {
+		panic("HTTP3Config.NewServer must not be nil")
+	}
+	l.http3 = cfg.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.server.Handler.ServeHTTP(w, r)
+	}))
+	l.UseWithPriority(PhasePreRouting, AltSvc(cfg.Port, cfg.MaxAge))
+}
+
+// AltSvc returns a middleware advertising HTTP/3 on port in the Alt-Svc header of TLS responses
+// (empty port: "443", zero maxAge: 24 hours). Requests already made over HTTP/3 are not advertised to.
+func AltSvc(port string, maxAge time.Duration) Middleware {
+	if port == "" {
+		port = "443"
+	}
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	value := fmt.Sprintf(`h3=":%s"; ma=%d`, port, int(maxAge/time.Second))
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && r.ProtoMajor < 3 {
+				w.Header().Set("Alt-Svc", value)
+			}
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package lightmux
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDGenerator generates request IDs, see RequestIDConfig.Generator.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a function to the IDGenerator interface.
+type IDGeneratorFunc func() string
+
+// NewID calls f.
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// RandomID generates 128-bit random hex IDs, the default of RequestIDMiddleware.
+func RandomID() IDGenerator {
+	return IDGeneratorFunc(newID)
+}
+
+// UUIDv7 generates RFC 9562 version 7 UUIDs, which sort by creation time (millisecond precision).
+func UUIDv7() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var b [16]byte
+		rand.Read(b[6:])
+		putUnixMilli48(b[:6], time.Now())
+
+		b[6] = 0x70 | b[6]&0x0f // version 7
+		b[8] = 0x80 | b[8]&0x3f // RFC 9562 variant
+
+		var s [36]byte
+		hex.Encode(s[0:8], b[0:4])
+		s[8] = '-'
+		hex.Encode(s[9:13], b[4:6])
+		s[13] = '-'
+		hex.Encode(s[14:18], b[6:8])
+		s[18] = '-'
+		hex.Encode(s[19:23], b[8:10])
+		s[23] = '-'
+		hex.Encode(s[24:], b[10:])
+		return string(s[:])
+	})
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates 26 character ULIDs (48-bit millisecond timestamp, 80 random bits), which sort by creation time.
+func ULID() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var b [16]byte
+		rand.Read(b[6:])
+		putUnixMilli48(b[:6], time.Now())
+
+		hi := binary.BigEndian.Uint64(b[:8])
+		lo := binary.BigEndian.Uint64(b[8:])
+
+		// 128 bits are encoded in 26 characters of 5 bits, the first one holding the top 3 bits.
+		var s [26]byte
+		for i := 25; i >= 0; i-- {
+			s[i] = crockford[lo&0x1f]
+			lo = lo>>5 | hi<<59
+			hi >>= 5
+		}
+		return string(s[:])
+	})
+}
+
+// SnowflakeEpoch is the epoch of Snowflake IDs (2024-01-01T00:00:00Z).
+var SnowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxSnowflakeNode is the largest node ID accepted by Snowflake.
+const MaxSnowflakeNode = 1<<10 - 1
+
+// snowflake generates 63-bit IDs: 41 bits of milliseconds since SnowflakeEpoch, 10 bits of node and 12 bits of sequence.
+type snowflake struct {
+	mu       sync.Mutex
+	node     int64
+	lastMsec int64
+	sequence int64
+}
+
+// Snowflake generates decimal snowflake IDs, unique across up to 1024 nodes and sortable by creation time.
+// It panics if node is not in [0, MaxSnowflakeNode].
+func Snowflake(node int64) IDGenerator {
+	if node < 0 || node > MaxSnowflakeNode {
+		panic(fmt.Sprintf("snowflake node must be between 0 and %d, got %d", MaxSnowflakeNode, node))
+	}
+	return &snowflake{node: node}
+}
+
+// NewID returns the next snowflake ID, waiting for the next millisecond when the sequence is exhausted.
+func (s *snowflake) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msec := time.Since(SnowflakeEpoch).Milliseconds()
+	if msec < s.lastMsec {
+		// clock moved backwards, keep IDs increasing
+		msec = s.lastMsec
+	}
+
+	if msec == s.lastMsec {
+		s.sequence = (s.sequence + 1) & 0xfff
+		if s.sequence == 0 {
+			for msec <= s.lastMsec {
+				time.Sleep(time.Millisecond / 10)
+				msec = time.Since(SnowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMsec = msec
+
+	return strconv.FormatInt(msec<<22|s.node<<12|s.sequence, 10)
+}
+
+// putUnixMilli48 writes the unix milliseconds of t as a 48-bit big-endian integer into b.
+func putUnixMilli48(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
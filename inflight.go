@@ -0,0 +1,102 @@
+package lightmux
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// InFlightRequest describes a request currently being served, see InFlight.
+type InFlightRequest struct {
+	Method string
+	Path   string
+	// Route is the pattern of the matched route, empty if none matched.
+	Route    string
+	Started  time.Time
+	Duration time.Duration
+}
+
+// inFlightTracker records the requests passing through the server handler.
+type inFlightTracker struct {
+	mu       sync.Mutex
+	requests map[*inFlightEntry]struct{}
+}
+
+type inFlightEntry struct {
+	method, host, path string
+	started            time.Time
+}
+
+// begin records r as in flight, the returned func removes it.
+func (t *inFlightTracker) begin(r *http.Request) func() {
+	entry := &inFlightEntry{method: r.Method, host: r.Host, path: r.URL.Path, started: time.Now()}
+
+	t.mu.Lock()
+	if t.requests == nil {
+		t.requests = make(map[*inFlightEntry]struct{})
+	}
+	t.requests[entry] = struct{}{}
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		delete(t.requests, entry)
+		t.mu.Unlock()
+	}
+}
+
+// InFlight returns the requests currently being served by Run or RunTLS, oldest first,
+// e.g. to see what a graceful shutdown is waiting on.
+func (l *LightMux) InFlight() []InFlightRequest {
+	l.inFlight.mu.Lock()
+	entries := make([]*inFlightEntry, 0, len(l.inFlight.requests))
+	for entry := range l.inFlight.requests {
+		entries = append(entries, entry)
+	}
+	l.inFlight.mu.Unlock()
+
+	now := time.Now()
+	requests := make([]InFlightRequest, 0, len(entries))
+	for _, entry := range entries {
+		req := &http.Request{Method: entry.method, Host: entry.host, URL: &url.URL{Path: entry.path}}
+		_, pattern := l.mux.Handler(req)
+		route := ""
+		if r, ok := l.routeMap[pattern]; ok {
+			route = r.Path
+		}
+		requests = append(requests, InFlightRequest{
+			Method:   entry.method,
+			Path:     entry.path,
+			Route:    route,
+			Started:  entry.started,
+			Duration: now.Sub(entry.started),
+		})
+	}
+	slices.SortFunc(requests, func(a, b InFlightRequest) int { return a.Started.Compare(b.Started) })
+	return requests
+}
+
+// Draining reports whether the server is shutting down: it stopped accepting connections
+// and waits for the in-flight requests to complete.
+func (l *LightMux) Draining() bool {
+	select {
+	case <-l.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// logInFlight logs the requests still in flight during shutdown.
+func (l *LightMux) logInFlight(msg string) {
+	requests := l.InFlight()
+	if len(requests) == 0 {
+		return
+	}
+	l.logger.Info(msg, "in_flight", len(requests))
+	for _, req := range requests {
+		l.logger.Info("in-flight request", "method", req.Method, "path", req.Path, "route", req.Route, "duration", req.Duration.Round(time.Millisecond))
+	}
+}
@@ -4,10 +4,16 @@ package lightmux
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +28,128 @@ type LightMux struct {
 
 	// globalMiddlewareStack holds the stack of global middlewares applied to all routes.
 	globalMiddlewareStack []Middleware
+	// globalPriorities holds the priorities of globalMiddlewareStack by index, see UseWithPriority.
+	globalPriorities []int
+
+	// namedMiddlewares are applied to every route unless skipped, see UseNamed.
+	namedMiddlewares []namedMiddleware
+
+	// versions holds the API versions created with VersionGroup, nil value means the version is not deprecated.
+	versions map[string]*Deprecation
+
+	// startHooks and stopHooks let subsystems (e.g. webhooks) follow the server lifecycle.
+	startHooks []func()
+	stopHooks  []func(ctx context.Context) error
+	// drainHooks release application resources after shutdown, see OnDrainComplete.
+	drainHooks []func(ctx context.Context) error
+
+	// stopOnce guards stopping the server, stopping is closed when it starts and stopped when it completed.
+	stopOnce sync.Once
+	stopping chan struct{}
+	stopped  chan struct{}
+	stopErr  error
+
+	// done is closed once serving ended with runErr, see Wait and Err.
+	doneOnce sync.Once
+	done     chan struct{}
+	runErr   error
+
+	// errorEncoder and errorHooks are used by Error to write error responses, see SetErrorEncoder and OnError.
+	errorEncoder ErrorEncoder
+	errorHooks   []func(r *http.Request, status int, err error)
+	// routerHooks observe dispatch decisions, see OnRouterEvent.
+	routerHooks []func(e RouterEvent)
+	// panicHooks enable the recovery layer, see OnPanic.
+	panicHooks []func(r *http.Request, recovered any, stack []byte)
+
+	// ipFamily selects the IP family of the listener, see SetIPFamily.
+	ipFamily IPFamily
+
+	// reload holds the hooks registered with OnReload.
+	reload reloader
+
+	// methodMismatch and notFound control responses for unmatched methods and paths.
+	methodMismatch MethodMismatch
+	notFound       http.HandlerFunc
+
+	// adminGuard protects built-in operational endpoints, see SetAdminGuard.
+	adminGuard Middleware
+
+	// certWatchInterval polls the RunTLS certificate files for changes, see SetCertWatchInterval.
+	certWatchInterval time.Duration
+
+	// tlsFallback selects RunTLS behavior for missing certificate files.
+	tlsFallback TLSFallback
+
+	// duplicates selects how duplicate route registrations are handled, see SetDuplicateRoutes.
+	duplicates DuplicateRoutes
+
+	// probes maps health probe paths to their checks, see Probe.
+	probes map[string]func() bool
+
+	// readinessPath and healthChecks serve the readiness endpoint, see EnableHealthEndpoints and AddHealthCheck.
+	readinessPath string
+	healthChecks  []*healthCheck
+	// healthDetails exposes check errors and timings on the readiness endpoint, see SetHealthDetails.
+	healthDetails bool
+
+	// afterHooks are called once the response has been written, see After.
+	afterHooks []AfterHook
+
+	// sloTrackers and sloHooks track route SLOs, see Route.SetSLO and OnSLOBurn.
+	sloTrackers []*sloTracker
+	sloHooks    []func(SLOStatus)
+	// errorWatchdogs track route error rates, see OnErrorRate.
+	errorWatchdogs []*errorWatchdog
+
+	// statsEnabled and counters hold per-route request counters, see EnableStats.
+	statsEnabled bool
+	counters     []*methodCounters
+
+	// metrics holds the Prometheus collectors, see EnableMetrics.
+	metrics *metricsRegistry
+	// metricsSinks receive request measurements, see AddMetricsSink.
+	metricsSinks []MetricsSink
+	// startedAt is when the server started, in Unix nanoseconds, zero before.
+	startedAt atomic.Int64
+
+	// logger receives lifecycle messages (startup, shutdown, reloads), see WithLogger.
+	logger Logger
+
+	// listenerOpts tunes accepted connections, see SetListenerOptions.
+	listenerOpts ListenerOptions
+
+	// proxyProto parses PROXY protocol headers of accepted connections, see EnableProxyProtocol.
+	proxyProto *proxyProtocol
+
+	// conns tracks connection states, see ConnStats and OnConnState.
+	conns connTracker
+
+	// connLimit caps open connections, see LimitConnections.
+	connLimit *connLimiter
+
+	// noDefaultTimeouts disables the default server timeouts, see SetDefaultTimeouts.
+	noDefaultTimeouts bool
+
+	// shutdownTimeout bounds the graceful shutdown of Run and RunTLS, see SetShutdownTimeout.
+	shutdownTimeout time.Duration
+	// drainDelay keeps the listeners open after shutdown began, see SetDrainDelay.
+	drainDelay time.Duration
+
+	// listeners are the additional listeners registered with AddListener.
+	listeners []*extraListener
+
+	// restart tracks the listeners handed over on graceful restart, see Restart.
+	restart restarter
+
+	// inFlight tracks the requests being served, see InFlight.
+	inFlight inFlightTracker
+
+	// http3 is the HTTP/3 server started with the listeners, see EnableHTTP3.
+	http3 HTTP3Server
+
+	// httpsRedirect configures the plain HTTP redirect listener of RunTLS, see RedirectHTTP.
+	httpsRedirect *HTTPSRedirectConfig
 }
 
 // NewLightMux creates and returns a new LightMux instance using the provided http.Server.
@@ -30,6 +158,13 @@ func NewLightMux(server *http.Server) *LightMux {
 		server:   server,
 		mux:      http.NewServeMux(),
 		routeMap: make(map[string]*Route),
+		versions: make(map[string]*Deprecation),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+
+		logger:          StdLogger(log.Default()),
+		shutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
@@ -46,109 +181,414 @@ func (l *LightMux) Mux() *http.ServeMux {
 func (l *LightMux) ApplyRoutes() {
 	for _, route := range l.routeMap {
 		route := route
-		allowed := allowedMethodsJoin(route.Methods)
+		for _, method := range route.replaced {
+			l.logger.Info("Route registered again, replaced its handler", "method", method, "path", route.Path)
+		}
+		route.replaced = nil
+		l.applyAdminGuard(route)
+		hide := l.methodMismatch == RespondNotFound
+		handlers, allowed := route.buildHandlers(!hide, l.namedMiddlewares)
+		instrument(route.Path, handlers, l.routeObservers(route, handlers))
+
+		deprecation := l.versions[route.Version]
+		track := l.tracksRequests() || route.cors != nil
 
 		l.mux.HandleFunc(route.Path, func(w http.ResponseWriter, r *http.Request) {
-			if handler, ok := route.Methods[r.Method]; ok {
-				handler.ServeHTTP(w, r)
-			} else {
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{
-					"error": fmt.Sprintf("%s method is not allowed, allowed methods for %s:[%s]", r.Method, r.URL.Path, allowed),
-				})
+			info := requestInfoFrom(r.Context())
+			if info == nil && track {
+				r, info = withRequestInfo(r)
+			}
+			if info != nil {
+				info.mux = l
+				info.route = route
+				info.routed = r
+			}
+
+			if deprecation != nil {
+				deprecation.setHeaders(w.Header())
+			}
+
+			if handler, ok := handlers[r.Method]; ok {
+				if !route.encodingAllowed(r) {
+					unsupportedEncoding(w, r, route.encodings)
+					return
+				}
+				l.serveRouteHandler(handler, route, w, r)
 				return
 			}
+
+			if hide {
+				if info != nil {
+					info.route = nil
+				}
+				l.serveNotFound(w, r)
+				return
+			}
+
+			l.emit(RouterEvent{Kind: EventMethodNotAllowed, Request: r, Route: route.Path})
+			w.Header().Set("Allow", allowed)
+			if route.methodNotAllowed != nil {
+				route.methodNotAllowed(w, r)
+				return
+			}
+
+			writeJSONError(w, http.StatusMethodNotAllowed,
+				fmt.Sprintf("%s method is not allowed, allowed methods for %s:[%s]", r.Method, r.URL.Path, allowed))
 		})
 	}
-}
 
-// PrintRoutes prints all registered routes and their supported methods.
-func (l *LightMux) PrintRoutes() {
-	for _, r := range l.routeMap {
-		fmt.Printf("Route: %s\n", r.Path)
-		for method, handler := range r.Methods {
-			fmt.Printf("\t- %s (handler: %s)\n", method, getFuncName(handler))
-		}
-		fmt.Printf("\tMiddlewares: %d\n", len(r.Middlewares))
-		for i, mw := range r.Middlewares {
-			fmt.Printf("\t\t%d: %T (%s)\n", i+1, mw, getFuncName(mw))
+	for path := range l.probes {
+		l.mux.HandleFunc(path, l.probeHandler)
+	}
+
+	if l.notFound != nil || len(l.routerHooks) > 0 {
+		if _, exists := l.routeMap["/"]; !exists {
+			l.mux.HandleFunc("/", l.serveNotFound)
 		}
 	}
 }
 
+// PrintRoutes prints all registered routes and their supported methods to stdout.
+//
+// Deprecated: use WriteRoutes, which accepts any io.Writer and output format.
+func (l *LightMux) PrintRoutes() {
+	l.WriteRoutes(os.Stdout, RoutesList)
+}
+
 // Run starts the HTTP server and blocks until the server stops.
-// It returns any error encountered while running the server.
-// The caller is responsible for managing context cancellation and graceful shutdown.
+// It returns any error encountered while running the server, such as a failed port bind or shutdown,
+// and never exits the process, so callers can release their own resources and test against Run.
+// Cancelling ctx triggers a graceful shutdown: active requests drain within the shutdown timeout
+// (see SetShutdownTimeout) and Run returns nil, so it composes with errgroup-style lifecycles.
+// Use Runner for signal handling.
 func (l *LightMux) Run(ctx context.Context) error {
+	return l.serve(ctx, ":http", l.server.Serve)
+}
+
+// RunTLS starts the HTTP server with TLS support.
+// It applies all registered routes and global middlewares before starting the server.
+// The caller is responsible for managing context cancellation and graceful shutdown.
+// Parameters:
+// - ctx: Context for managing server lifecycle.
+// - certFile: Path to the TLS certificate file.
+// - keyFile: Path to the TLS key file.
+// Returns:
+// - An error if the server fails to start or shut down properly.
+//
+// The certificate is reloaded from the files by Reload (and SIGHUP with OnReload hooks registered),
+// and whenever the files change if SetCertWatchInterval is set.
+// When the certificate or key file is missing, the TLSFallback set with SetTLSFallback decides
+// whether to fail, serve plain HTTP in degraded mode or wait for the files to appear.
+func (l *LightMux) RunTLS(ctx context.Context, certFile, keyFile string) error {
+	if missing := missingTLSFiles(certFile, keyFile); len(missing) > 0 {
+		switch l.tlsFallback.Mode {
+		case TLSFallbackHTTP:
+			l.logger.Info("TLS files are missing, starting in degraded HTTP-only mode", "files", missing)
+			return l.serve(ctx, ":https", l.server.Serve)
+
+		case TLSFallbackWait:
+			l.logger.Info("TLS files are missing, waiting for them to appear...", "files", missing)
+			if err := l.waitTLSFiles(ctx, certFile, keyFile); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	l.addHTTPSRedirectListener()
+
+	cfg := l.server.TLSConfig
+	if cfg != nil && (len(cfg.Certificates) > 0 || cfg.GetCertificate != nil || cfg.GetConfigForClient != nil) {
+		return l.serve(ctx, ":https", func(ln net.Listener) error {
+			return l.server.ServeTLS(ln, certFile, keyFile)
+		})
+	}
+
+	cert, err := l.reloadableCertFiles(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	cfg.GetCertificate = cert.GetCertificate
+	l.server.TLSConfig = cfg
+
+	return l.serve(ctx, ":https", func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, "", "")
+	})
+}
+
+// RunTLSWithRedirect runs RunTLS together with a plain HTTP listener redirecting every request to HTTPS,
+// configured with RedirectHTTP or listening on :http by default. Both listeners share one shutdown path.
+func (l *LightMux) RunTLSWithRedirect(ctx context.Context, certFile, keyFile string) error {
+	if l.httpsRedirect == nil {
+		l.RedirectHTTP(HTTPSRedirectConfig{})
+	}
+	return l.RunTLS(ctx, certFile, keyFile)
+}
+
+// tracksRequests reports whether the dispatcher must attach request info even when
+// the request did not pass through the server handler (e.g. when Mux() is used directly).
+func (l *LightMux) tracksRequests() bool {
+	return l.errorEncoder != nil || len(l.errorHooks) > 0
+}
+
+// serve starts the server with serveFn (defaultAddr is used when the server has no Addr) and blocks
+// until ctx is cancelled or the server fails. Stop hooks run after the server stopped.
+func (l *LightMux) serve(ctx context.Context, defaultAddr string, serveFn func(ln net.Listener) error) error {
+	errCh, err := l.start(defaultAddr, serveFn)
+	if err != nil {
+		l.finish(err)
+		return err
+	}
+	err = l.wait(ctx, errCh)
+	l.finish(err)
+	return err
+}
+
+// start applies routes and global middlewares, opens the listeners, runs start hooks and starts serving
+// in the background. Serve errors are sent to the returned channel.
+func (l *LightMux) start(defaultAddr string, serveFn func(ln net.Listener) error) (<-chan error, error) {
 	l.ApplyRoutes()
 	l.ApplyGlobalMiddlewares()
+	l.applyDefaultTimeouts()
+	l.trackConnState()
+	l.startedAt.Store(time.Now().UnixNano())
 
-	errCh := make(chan error, 1)
+	ln, err := l.listen(l.server.Addr, defaultAddr)
+	if err != nil {
+		return nil, err
+	}
+	extraLns, err := l.listenExtra()
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
 
+	for _, start := range l.startHooks {
+		start()
+	}
+
+	errCh := make(chan error, len(extraLns)+2)
+
+	l.logger.Info("Starting LightMux", "addr", ln.Addr().String())
 	go func() {
-		log.Println("Starting LightMux on", l.server.Addr)
-		if err := l.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serveFn(ln); err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 	}()
+	for i, extraLn := range extraLns {
+		l.logger.Info("Starting LightMux", "addr", extraLn.Addr().String())
+		go func() {
+			if err := l.listeners[i].serve(extraLn); err != nil && err != http.ErrServerClosed {
+				errCh <- err
+			}
+		}()
+	}
+	if l.http3 != nil {
+		l.logger.Info("Starting LightMux HTTP/3 listener")
+		go func() {
+			if err := l.http3.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("lightmux: HTTP/3: %w", err)
+			}
+		}()
+	}
+	return errCh, nil
+}
+
+// wait blocks until ctx is cancelled, Shutdown or Close is called or a listener fails, and stops the server.
+func (l *LightMux) wait(ctx context.Context, errCh <-chan error) error {
+	newShutdownCtx := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), l.shutdownTimeout)
+	}
 
 	select {
 	case <-ctx.Done():
-		log.Println("Context cancelled, shutting down server...")
+		l.logger.Info("Context cancelled, shutting down server...")
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownCtx, cancel := newShutdownCtx()
 		defer cancel()
 
-		if err := l.server.Shutdown(shutdownCtx); err != nil {
+		if err := l.stop(shutdownCtx, l.shutdownServers); err != nil {
 			return err
 		}
 
-		log.Println("Server shutdown complete.")
+		l.logger.Info("Server shutdown complete.")
+		return nil
+
+	case <-l.stopping:
+		// Shutdown or Close was called, they report their own errors
+		<-l.stopped
 		return nil
 
 	case err := <-errCh:
+		stopCtx, cancel := newShutdownCtx()
+		defer cancel()
+
+		return errors.Join(err, l.stop(stopCtx, l.shutdownServers))
+	}
+}
+
+// Start starts serving plain HTTP like Run, but returns as soon as the listeners are open, so LightMux can run
+// next to other servers or workers in the same process. Stop it with Shutdown or Close, and use Wait or Err
+// to learn how serving ended. Listen errors are returned directly.
+func (l *LightMux) Start() error {
+	errCh, err := l.start(":http", l.server.Serve)
+	if err != nil {
+		l.finish(err)
 		return err
 	}
+	go func() {
+		l.finish(l.wait(context.Background(), errCh))
+	}()
+	return nil
 }
 
-// RunTLS starts the HTTP server with TLS support.
-// It applies all registered routes and global middlewares before starting the server.
-// The caller is responsible for managing context cancellation and graceful shutdown.
-// Parameters:
-// - ctx: Context for managing server lifecycle.
-// - certFile: Path to the TLS certificate file.
-// - keyFile: Path to the TLS key file.
-// Returns:
-// - An error if the server fails to start or shut down properly.
-func (l *LightMux) RunTLS(ctx context.Context, certFile, keyFile string) error {
-	l.ApplyRoutes()
-	l.ApplyGlobalMiddlewares()
+// Wait blocks until the server started with Start, Run or RunTLS stopped and returns Err.
+func (l *LightMux) Wait() error {
+	<-l.done
+	return l.runErr
+}
 
-	errCh := make(chan error, 1)
+// Err returns the error serving ended with, nil while the server is running or if it stopped cleanly.
+func (l *LightMux) Err() error {
+	select {
+	case <-l.done:
+		return l.runErr
+	default:
+		return nil
+	}
+}
 
-	go func() {
-		log.Println("Starting LightMux on", l.server.Addr)
-		if err := l.server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
-			errCh <- err
+// finish records the result of serving and releases Wait, once.
+func (l *LightMux) finish(err error) {
+	l.doneOnce.Do(func() {
+		l.runErr = err
+		close(l.done)
+	})
+}
+
+// DefaultShutdownTimeout is the graceful shutdown timeout of Run and RunTLS unless set with SetShutdownTimeout.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// SetShutdownTimeout sets how long Run and RunTLS wait for active requests (e.g. long downloads or streams)
+// and stop hooks when their context is cancelled. Zero or negative values restore DefaultShutdownTimeout.
+func (l *LightMux) SetShutdownTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultShutdownTimeout
+	}
+	l.shutdownTimeout = d
+}
+
+// SetDrainDelay sets how long shutdown keeps the listeners open after readiness started failing
+// (see EnableHealthEndpoints), giving load balancers time to stop routing new requests.
+// The delay counts towards the shutdown timeout; Close skips it.
+func (l *LightMux) SetDrainDelay(d time.Duration) {
+	l.drainDelay = d
+}
+
+// Shutdown gracefully stops the server: it stops accepting connections, waits for active requests
+// to complete within ctx and runs the stop hooks (e.g. draining webhooks). Run then returns nil.
+// Calling it again waits for the first call and returns its error.
+// Like http.Server, a LightMux cannot be started again after Shutdown.
+func (l *LightMux) Shutdown(ctx context.Context) error {
+	return l.stop(ctx, l.shutdownServers)
+}
+
+// Close immediately closes the server and all its connections, then runs the stop hooks
+// with an already cancelled context so they abandon pending work. Run then returns nil.
+func (l *LightMux) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return l.stop(ctx, l.closeServers)
+}
+
+// stop stops the server with stopServer and runs the stop hooks, once. Later calls wait for the first one.
+func (l *LightMux) stop(ctx context.Context, stopServer func(ctx context.Context) error) error {
+	first := false
+	l.stopOnce.Do(func() {
+		first = true
+		close(l.stopping)
+		l.logger.Debug("Readiness failing, draining", "delay", l.drainDelay)
+		if l.drainDelay > 0 {
+			timer := time.NewTimer(l.drainDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
 		}
-	}()
+		l.logInFlight("draining")
+		serverErr := stopServer(ctx)
+		if serverErr != nil {
+			l.logInFlight("shutdown incomplete")
+		}
+		l.logger.Debug("Listeners closed, running stop and drain hooks", "drain_hooks", len(l.drainHooks))
+		l.stopErr = errors.Join(serverErr, l.runStopHooks(ctx), l.runDrainHooks(ctx))
+		close(l.stopped)
+	})
+	if first {
+		return l.stopErr
+	}
 
 	select {
+	case <-l.stopped:
+		return l.stopErr
+	default:
+	}
+	select {
+	case <-l.stopped:
+		return l.stopErr
 	case <-ctx.Done():
-		log.Println("Context cancelled, shutting down server...")
+		return ctx.Err()
+	}
+}
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+// onStart registers a function called right before the server starts listening.
+func (l *LightMux) onStart(fn func()) {
+	l.startHooks = append(l.startHooks, fn)
+}
 
-		if err := l.server.Shutdown(shutdownCtx); err != nil {
-			return err
-		}
+// onStop registers a function called after the server stopped serving requests.
+func (l *LightMux) onStop(fn func(ctx context.Context) error) {
+	l.stopHooks = append(l.stopHooks, fn)
+}
 
-		log.Println("Server shutdown complete.")
-		return nil
+// OnDrainComplete registers a hook releasing an application resource (database pool, message consumer, cache)
+// once all HTTP requests drained and the built-in subsystems stopped. Hooks run in registration order
+// within the shutdown context; their errors are returned by Run, Shutdown and Close.
+func (l *LightMux) OnDrainComplete(fn func(ctx context.Context) error) {
+	l.drainHooks = append(l.drainHooks, fn)
+}
 
-	case err := <-errCh:
-		return err
+// RegisterCloser closes c once all HTTP requests drained, see OnDrainComplete.
+func (l *LightMux) RegisterCloser(c io.Closer) {
+	l.OnDrainComplete(func(context.Context) error { return c.Close() })
+}
+
+// runDrainHooks calls the OnDrainComplete hooks in registration order and joins their errors.
+func (l *LightMux) runDrainHooks(ctx context.Context) error {
+	var errs []error
+	for _, hook := range l.drainHooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runStopHooks calls stop hooks in reverse registration order and joins their errors.
+func (l *LightMux) runStopHooks(ctx context.Context) error {
+	var errs []error
+	for i := len(l.stopHooks) - 1; i >= 0; i-- {
+		if err := l.stopHooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
@@ -1,9 +1,37 @@
 package lightmux
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestMiddlewareExecution(t *testing.T) {
@@ -165,6 +193,39 @@ func TestServerState(t *testing.T) {
 	lmux.PrintMiddlewareInfo()
 }
 
+func TestWriteRoutes(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	users := lmux.NewRoute("/users", func(next http.HandlerFunc) http.HandlerFunc { return next })
+	users.Handle(http.MethodPost, noop)
+	users.Handle(http.MethodGet, noop)
+	lmux.NewRoute("/health").Handle(http.MethodGet, noop)
+
+	var compact bytes.Buffer
+	if err := lmux.WriteRoutes(&compact, RoutesCompact); err != nil {
+		t.Fatalf("WriteRoutes failed: %v", err)
+	}
+	if got := compact.String(); got != "GET /health\nGET,POST /users\n" {
+		t.Fatalf("unexpected compact output: %q", got)
+	}
+
+	var table bytes.Buffer
+	lmux.WriteRoutes(&table, RoutesTable)
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "METHOD  PATH") || !strings.HasPrefix(lines[3], "POST    /users ") ||
+		!strings.HasSuffix(lines[3], "1") {
+		t.Fatalf("unexpected table output:\n%s", table.String())
+	}
+
+	var first, second bytes.Buffer
+	lmux.WriteRoutes(&first, RoutesList)
+	lmux.WriteRoutes(&second, RoutesList)
+	if first.String() != second.String() || !strings.HasPrefix(first.String(), "Global middlewares: 0\nRoute: /health\n") {
+		t.Fatalf("expected stable list output:\n%s", first.String())
+	}
+}
+
 func Test404HandlerResponse(t *testing.T) {
 
 	var called string
@@ -197,3 +258,4191 @@ func Test404HandlerResponse(t *testing.T) {
 		t.Fatalf("unexpected called value: %s, wanted: bar", called)
 	}
 }
+
+func TestRouteTemplateInstantiate(t *testing.T) {
+
+	var called []string
+
+	tagMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			called = append(called, "tag")
+			next(w, r)
+		}
+	}
+
+	tmpl := NewRouteTemplate("/{id}", tagMiddleware).WithMetadata("resource", true)
+
+	lmux := NewLightMux(&http.Server{})
+	users := tmpl.Instantiate(lmux, "/users", map[string]http.HandlerFunc{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			called = append(called, "user "+r.PathValue("id"))
+		},
+	})
+	tmpl.Instantiate(lmux.NewGroup("/api"), "/posts", map[string]http.HandlerFunc{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			called = append(called, "post "+r.PathValue("id"))
+		},
+	})
+
+	if users.Path != "/users/{id}" || users.Metadata["resource"] != true {
+		t.Fatalf("unexpected route: %s %v", users.Path, users.Metadata)
+	}
+
+	lmux.ApplyRoutes()
+
+	for _, path := range []string{"/users/1", "/api/posts/2"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	mustResult := []string{"tag", "user 1", "tag", "post 2"}
+	for i := range mustResult {
+		if mustResult[i] != called[i] {
+			t.Fatalf("template call order failed: %s != %s", mustResult[i], called[i])
+		}
+	}
+}
+
+func TestVersionGroupDeprecation(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	v1 := lmux.VersionGroup("v1")
+	v2 := lmux.VersionGroup("v2")
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	old := v1.ContinueGroup("/users").NewRoute("/list")
+	old.Handle(http.MethodGet, handler)
+	v1.NewRoute("/accounts").Handle(http.MethodGet, handler)
+	v2.NewRoute("/users").Handle(http.MethodGet, handler)
+	v3 := lmux.VersionGroup("v3")
+	v3.NewRoute("/users").Handle(http.MethodGet, handler)
+
+	if old.Path != "/v1/users/list" || old.Version != "v1" {
+		t.Fatalf("unexpected route: %s (%s)", old.Path, old.Version)
+	}
+	if routes := lmux.VersionRoutes("v1"); len(routes) != 2 || routes[0].Path != "/v1/accounts" || routes[1].Path != "/v1/users/list" {
+		t.Fatalf("expected v1 routes sorted by path, got %v", routes)
+	}
+
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lmux.DeprecateVersion("v1", Deprecation{Date: time.Unix(1700000000, 0), Sunset: sunset})
+	lmux.DeprecateVersion("v3", Deprecation{})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/list", nil))
+	if got := w.Header().Get("Deprecation"); got != "@1700000000" {
+		t.Fatalf("unexpected Deprecation header: %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Tue, 01 Jan 2030 00:00:00 GMT" {
+		t.Fatalf("unexpected Sunset header: %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/users", nil))
+	if got := w.Header().Get("Deprecation"); got != "" {
+		t.Fatalf("v2 must not be deprecated, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v3/users", nil))
+	unix, err := strconv.ParseInt(strings.TrimPrefix(w.Header().Get("Deprecation"), "@"), 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)) > time.Minute {
+		t.Fatalf("expected an RFC 9745 Deprecation date without Date, got %q", w.Header().Get("Deprecation"))
+	}
+}
+
+type testUserController struct {
+	called *[]string
+}
+
+func (c testUserController) Index(w http.ResponseWriter, r *http.Request) {
+	*c.called = append(*c.called, "index")
+}
+
+func (c testUserController) Show(w http.ResponseWriter, r *http.Request) {
+	*c.called = append(*c.called, "show "+r.PathValue(ResourceIDParam))
+}
+
+func (c testUserController) Delete(w http.ResponseWriter, r *http.Request) {
+	*c.called = append(*c.called, "delete "+r.PathValue(ResourceIDParam))
+}
+
+func (c testUserController) ActionMiddlewares(action ResourceAction) []Middleware {
+	if action != ActionDelete {
+		return nil
+	}
+	return []Middleware{func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*c.called = append(*c.called, "admin")
+			next(w, r)
+		}
+	}}
+}
+
+func TestGroupResource(t *testing.T) {
+
+	var called []string
+
+	lmux := NewLightMux(&http.Server{})
+	res := lmux.NewGroup("/api").Resource("/users", testUserController{called: &called})
+	lmux.ApplyRoutes()
+
+	if res.Collection.Path != "/api/users" || res.Member.Path != "/api/users/{id}" {
+		t.Fatalf("unexpected resource paths: %s, %s", res.Collection.Path, res.Member.Path)
+	}
+
+	requests := []struct{ method, path string }{
+		{http.MethodGet, "/api/users"},
+		{http.MethodGet, "/api/users/7"},
+		{http.MethodDelete, "/api/users/7"},
+	}
+	for _, rq := range requests {
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(rq.method, rq.path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status for missing Create: %d", w.Code)
+	}
+
+	mustResult := []string{"index", "show 7", "admin", "delete 7"}
+	for i := range mustResult {
+		if mustResult[i] != called[i] {
+			t.Fatalf("resource call order failed: %s != %s", mustResult[i], called[i])
+		}
+	}
+}
+
+func TestGroupMethodNotAllowed(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	web := lmux.NewGroup("/web")
+	web.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("<h1>nope</h1>"))
+	})
+	web.ContinueGroup("/pages").NewRoute("/home").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.NewGroup("/api").NewRoute("/home").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/web/pages/home", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "<h1>nope</h1>" || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Fatalf("unexpected web response: %d %q %q", w.Code, w.Body.String(), w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/home", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected api response: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestWebhookRetryAndSignature(t *testing.T) {
+
+	var attempts atomic.Int32
+	secret := []byte("secret")
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + SignWebhook(secret, r.Header.Get("X-Webhook-Timestamp"), body)
+		if r.Header.Get("X-Webhook-Signature") != want {
+			t.Errorf("bad signature: %s", r.Header.Get("X-Webhook-Signature"))
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	d := NewWebhookDispatcher(WebhookConfig{Secret: secret, BaseBackoff: time.Millisecond})
+	d.Start()
+	if _, err := d.Send(Webhook{URL: receiver.URL, Event: "user.created", Payload: []byte(`{"id":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := d.Deliveries()
+	if len(deliveries) != 3 || deliveries[2].Status != http.StatusNoContent || deliveries[2].Err != nil {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Duration <= 0 {
+			t.Fatalf("expected a delivery duration, got %+v", delivery)
+		}
+	}
+	if _, err := d.Send(Webhook{URL: receiver.URL}); err != ErrWebhookDispatcherClosed {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+type testTx struct {
+	result *string
+}
+
+func (tx testTx) Commit() error {
+	*tx.result = "commit"
+	return nil
+}
+
+func (tx testTx) Rollback() error {
+	*tx.result = "rollback"
+	return nil
+}
+
+func TestTransactionMiddleware(t *testing.T) {
+
+	var result string
+	beginner := BeginnerFunc(func(ctx context.Context) (Tx, error) {
+		return testTx{result: &result}, nil
+	})
+
+	lmux := NewLightMux(&http.Server{})
+	route := lmux.NewRoute("/tx", Transaction(beginner))
+	route.Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		if RequestTx(r) == nil {
+			t.Fatal("transaction missing in context")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	route.Handle(http.MethodPut, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	route.Handle(http.MethodDelete, func(w http.ResponseWriter, r *http.Request) {
+		AbortTx(r, io.ErrUnexpectedEOF)
+	})
+	lmux.ApplyRoutes()
+
+	cases := map[string]string{
+		http.MethodPost:   "commit",
+		http.MethodPut:    "rollback",
+		http.MethodDelete: "rollback",
+	}
+	for method, want := range cases {
+		result = ""
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/tx", nil))
+		if result != want {
+			t.Fatalf("%s: expected %s, got %s", method, want, result)
+		}
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestLogger(RequestLoggerConfig{
+		Logger: logger,
+		Attrs: func(r *http.Request, status int) []slog.Attr {
+			return []slog.Attr{slog.String("tenant", "acme")}
+		},
+	}))
+	lmux.NewRoute("/users/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("tea"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["route"] != "/users/{id}" || record["status"] != float64(http.StatusTeapot) ||
+		record["bytes"] != float64(3) || record["tenant"] != "acme" || record["level"] != "WARN" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+}
+
+func TestWithLogAttrs(t *testing.T) {
+
+	var logs, access bytes.Buffer
+	authenticate := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			WithLogAttrs(r, slog.String("user_id", "u1"), slog.String("tenant", "unknown"))
+			next(w, r)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(
+		RequestLogger(RequestLoggerConfig{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}),
+		AccessLog(AccessLogConfig{Output: &access, Format: JSONLogFormat}),
+	)
+	lmux.NewRoute("/orders", authenticate).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		WithLogAttrs(r, slog.String("tenant", "acme"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil || record["user_id"] != "u1" || record["tenant"] != "acme" {
+		t.Fatalf("unexpected request log record %q: %v", logs.String(), err)
+	}
+	var line struct {
+		Attrs map[string]any `json:"attrs"`
+	}
+	if err := json.Unmarshal(access.Bytes(), &line); err != nil || line.Attrs["user_id"] != "u1" || line.Attrs["tenant"] != "acme" {
+		t.Fatalf("unexpected access log line %q: %v", access.String(), err)
+	}
+}
+
+func TestRequestLoggerHijack(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestLogger(RequestLoggerConfig{Logger: slog.New(slog.NewJSONHandler(io.Discard, nil))}))
+	lmux.NewRoute("/ws").Handle(http.MethodGet, hijackHandler)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	assertHijack(t, lmux.server.Handler, "/ws")
+}
+
+func TestRequestLoggerSampling(t *testing.T) {
+
+	var buf bytes.Buffer
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestLogger(RequestLoggerConfig{
+		Logger:           slog.New(slog.NewJSONHandler(&buf, nil)),
+		SampleRate:       1e-9,
+		RouteSampleRates: map[string]float64{"/audit": 1},
+	}))
+	lmux.NewRoute("/hot").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	lmux.NewRoute("/audit").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for range 100 {
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hot", nil))
+	}
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hot?fail", nil))
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/audit", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"status":500`) || !strings.Contains(lines[1], `"route":"/audit"`) {
+		t.Fatalf("expected only the error and the overridden route to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestRequestLoggerSilencedRoute(t *testing.T) {
+
+	var buf bytes.Buffer
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestLogger(RequestLoggerConfig{
+		Logger:           slog.New(slog.NewJSONHandler(&buf, nil)),
+		RouteSampleRates: map[string]float64{"/healthz": 0},
+	}))
+	lmux.NewRoute("/healthz").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("fail") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	lmux.NewRoute("/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for _, target := range []string{"/healthz", "/healthz", "/users", "/healthz?fail"} {
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"route":"/users"`) || !strings.Contains(lines[1], `"status":503`) {
+		t.Fatalf("expected the silenced route to log only errors, got:\n%s", buf.String())
+	}
+}
+
+func TestAudit(t *testing.T) {
+
+	var entries []AuditEntry
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(Audit(AuditConfig{
+		Sink: AuditSinkFunc(func(ctx context.Context, e AuditEntry) error {
+			entries = append(entries, e)
+			return nil
+		}),
+		Methods: []string{http.MethodPost},
+		Redact:  []string{"token"},
+	}))
+	users := lmux.NewRoute("/users/{id}")
+	users.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	users.Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	req := httptest.NewRequest(http.MethodPost, "/users/7?notify=yes&Token=abc", nil)
+	req.SetBasicAuth("alice", "secret")
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(entries) != 1 {
+		t.Fatalf("expected only the POST to be audited, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Actor != "alice" || e.Route != "/users/{id}" || e.Status != http.StatusCreated ||
+		e.Params["id"] != "7" || e.Params["notify"] != "yes" || e.Params["Token"] != AuditRedacted {
+		t.Fatalf("unexpected audit entry: %+v", e)
+	}
+}
+
+func TestAuditSinkErrorLogged(t *testing.T) {
+
+	var logs bytes.Buffer
+	lmux := New(WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	lmux.Use(Audit(AuditConfig{Sink: AuditSinkFunc(func(ctx context.Context, e AuditEntry) error {
+		return errors.New("table locked")
+	})}))
+	lmux.NewRoute("/users").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil))
+	if !strings.Contains(logs.String(), `"msg":"audit sink","error":"table locked"`) {
+		t.Fatalf("expected the sink error in the configured logger, got %q", logs.String())
+	}
+}
+
+func TestAuditCancelledRequest(t *testing.T) {
+
+	var sinkErr error
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(Audit(AuditConfig{Sink: AuditSinkFunc(func(ctx context.Context, e AuditEntry) error {
+		sinkErr = ctx.Err()
+		return nil
+	})}))
+	lmux.NewRoute("/users").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil).WithContext(ctx))
+	if sinkErr != nil {
+		t.Fatalf("expected the sink to get a live context after the client left, got %v", sinkErr)
+	}
+}
+
+func TestAuditPanic(t *testing.T) {
+
+	var entries []AuditEntry
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnPanic(func(r *http.Request, p any, s []byte) {})
+	lmux.Use(Audit(AuditConfig{Sink: AuditSinkFunc(func(ctx context.Context, e AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})}))
+	lmux.NewRoute("/users").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the panic to go on to the recovery layer, got %d", rec.Code)
+	}
+	if len(entries) != 1 || entries[0].Status != http.StatusInternalServerError || entries[0].Route != "/users" {
+		t.Fatalf("expected the panicking request to be audited as 500, got %+v", entries)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+
+	var buf bytes.Buffer
+	var outgoing http.Header
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestLogger(RequestLoggerConfig{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}))
+	lmux.Use(TraceContextMiddleware(TraceContextConfig{}))
+	lmux.NewRoute("/orders").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		outgoing = make(http.Header)
+		InjectTraceContext(r, outgoing)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("X-Trace-ID") != traceID {
+		t.Fatalf("expected the incoming trace ID in the response, got %q", rec.Header().Get("X-Trace-ID"))
+	}
+	child, ok := ParseTraceparent(outgoing.Get("traceparent"))
+	if !ok || child.TraceID != traceID || child.SpanID == "00f067aa0ba902b7" || !child.Sampled() ||
+		outgoing.Get("tracestate") != "congo=t61rcWkgMzE" {
+		t.Fatalf("unexpected outgoing trace context: %v", outgoing)
+	}
+	if !strings.Contains(buf.String(), `"trace_id":"`+traceID+`"`) {
+		t.Fatalf("expected the trace ID in the log record, got %s", buf.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	rec = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Trace-ID"); len(id) != 32 || id == "00000000000000000000000000000000" {
+		t.Fatalf("expected a new trace for an invalid traceparent, got %q", id)
+	}
+}
+
+func TestScopedLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(ScopedLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	lmux.Use(RequestIDMiddleware(RequestIDConfig{}))
+	lmux.NewRoute("/users/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r).Info("loading user")
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "loading user" || record["method"] != "GET" || record["path"] != "/users/1" ||
+		record["route"] != "/users/{id}" || record["request_id"] != "req-42" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+
+	if LoggerFrom(httptest.NewRequest(http.MethodGet, "/", nil)) != slog.Default() {
+		t.Fatal("expected the default logger outside of ScopedLogger")
+	}
+}
+
+func TestGroupCORSPreflight(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	api := lmux.NewGroup("/api", CORS(CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		MaxAge:         10 * time.Minute,
+	}))
+	api.NewRoute("/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	lmux.ApplyRoutes()
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Authorization" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("unexpected preflight response: %d %v", w.Code, w.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected response for disallowed origin: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+
+	etag := ETag([]byte("v1"))
+	modTime := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		header, value string
+		want          error
+	}{
+		{"If-Match", etag, nil},
+		{"If-Match", `"other", ` + etag, nil},
+		{"If-Match", "W/" + etag, ErrPreconditionFailed},
+		{"If-Match", `"stale"`, ErrPreconditionFailed},
+		{"If-Match", "*", nil},
+		{"If-Unmodified-Since", modTime.Format(http.TimeFormat), nil},
+		{"If-Unmodified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), ErrPreconditionFailed},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPut, "/users/1", nil)
+		req.Header.Set(c.header, c.value)
+		if err := CheckPreconditions(req, etag, modTime); err != c.want {
+			t.Fatalf("%s: %s: expected %v, got %v", c.header, c.value, c.want, err)
+		}
+	}
+}
+
+func TestEnforcePreconditions(t *testing.T) {
+
+	var reported error
+	etag := ETag([]byte("v1"))
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/users/{id}").Handle(http.MethodPut, func(w http.ResponseWriter, r *http.Request) {
+		if EnforcePreconditions(w, r, etag, time.Time{}) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodPut, "/users/1", nil)
+	req.Header.Set("If-Match", `"stale"`)
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed || reported != ErrPreconditionFailed {
+		t.Fatalf("expected 412 with ErrPreconditionFailed, got %d %v", w.Code, reported)
+	}
+
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected matching ETag to proceed, got %d", w.Code)
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("redis unavailable")
+}
+
+func TestMiddlewareErrorsUseLogger(t *testing.T) {
+
+	var muxLogs, limiterLogs bytes.Buffer
+	lmux := New(WithLogger(slog.New(slog.NewJSONHandler(&muxLogs, nil))))
+	lmux.NewRoute("/tx", Transaction(BeginnerFunc(func(ctx context.Context) (Tx, error) {
+		return nil, errors.New("pool exhausted")
+	}))).Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.NewRoute("/limited", RateLimiter(RateLimitConfig{
+		Limit:  RateLimit{Rate: 1, Per: time.Second},
+		Store:  failingRateLimitStore{},
+		Logger: slog.New(slog.NewJSONHandler(&limiterLogs, nil)),
+	})).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tx", nil))
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+	if !strings.Contains(muxLogs.String(), `"msg":"begin transaction"`) || !strings.Contains(muxLogs.String(), `"error":"pool exhausted"`) {
+		t.Fatalf("expected the transaction error in the LightMux logger, got %q", muxLogs.String())
+	}
+	if !strings.Contains(limiterLogs.String(), `"msg":"rate limit store","error":"redis unavailable"`) {
+		t.Fatalf("expected the store error in the configured logger, got %q", limiterLogs.String())
+	}
+}
+
+func TestTransactionBeginError(t *testing.T) {
+
+	var reported error
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/tx", Transaction(BeginnerFunc(func(ctx context.Context) (Tx, error) {
+		return nil, errors.New("pool exhausted")
+	}))).Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not run without a transaction")
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tx", nil))
+	if w.Code != http.StatusInternalServerError || !errors.Is(reported, ErrBeginTx) || reported.Error() != "failed to begin transaction: pool exhausted" {
+		t.Fatalf("expected 500 with ErrBeginTx, got %d %v", w.Code, reported)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	var reported error
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/limited", RateLimiter(RateLimitConfig{
+		Limit: RateLimit{Rate: 2, Per: time.Minute},
+	})).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	statuses := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, want := range statuses {
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/limited", nil))
+		if w.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, w.Code)
+		}
+		if i == 2 && (w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("Retry-After") != "30") {
+			t.Fatalf("unexpected rate limit headers: %v", w.Header())
+		}
+	}
+	if reported != ErrRateLimited {
+		t.Fatalf("expected ErrRateLimited to be reported, got %v", reported)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("other client must not be limited, got %d", w.Code)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+
+	var reported error
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/ws", WebSocketOrigin(SameOrigin())).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	cases := map[string]int{
+		"http://example.com": http.StatusSwitchingProtocols,
+		"http://evil.com":    http.StatusForbidden,
+	}
+	for origin, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/ws", nil)
+		req.Header.Set("Connection", "keep-alive, Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s: expected %d, got %d", origin, want, w.Code)
+		}
+	}
+	if !errors.Is(reported, ErrOriginNotAllowed) || reported.Error() != "websocket origin not allowed: http://evil.com" {
+		t.Fatalf("expected ErrOriginNotAllowed to be reported, got %v", reported)
+	}
+}
+
+func TestListenIPFamilyValidation(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+
+	lmux.SetIPFamily(IPv4Only)
+	if _, err := lmux.listen(ListenAddr("::1", 0), ":http"); err == nil {
+		t.Fatal("expected error for IPv6 address with IPv4-only family")
+	}
+
+	lmux.SetIPFamily(IPv6Only)
+	if _, err := lmux.listen("127.0.0.1:0", ":http"); err == nil {
+		t.Fatal("expected error for IPv4 address with IPv6-only family")
+	}
+
+	lmux.SetIPFamily(IPv4Only)
+	ln, err := lmux.listen("127.0.0.1:0", ":http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+
+	var seen []string
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestIDMiddleware(RequestIDConfig{}))
+	lmux.NewRoute("/id").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, RequestID(r))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set(DefaultRequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if seen[0] != "abc-123" || w.Header().Get(DefaultRequestIDHeader) != "abc-123" {
+		t.Fatalf("incoming request ID not reused: %q", seen[0])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set(DefaultRequestIDHeader, "bad id")
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if len(seen[1]) != 32 || w.Header().Get(DefaultRequestIDHeader) != seen[1] {
+		t.Fatalf("invalid request ID not replaced: %q", seen[1])
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+
+	for name, gen := range map[string]IDGenerator{"uuidv7": UUIDv7(), "ulid": ULID(), "snowflake": Snowflake(1)} {
+		first := gen.NewID()
+		time.Sleep(2 * time.Millisecond)
+		second := gen.NewID()
+
+		if !validRequestID(first) || first >= second {
+			t.Fatalf("%s: IDs must be valid and sort by time, got %q then %q", name, first, second)
+		}
+	}
+
+	if id := UUIDv7().NewID(); len(id) != 36 || id[14] != '7' {
+		t.Fatalf("unexpected UUIDv7 format: %q", id)
+	}
+	if id := ULID().NewID(); len(id) != 26 {
+		t.Fatalf("unexpected ULID length: %q", id)
+	}
+}
+
+func TestRobotsAndFavicon(t *testing.T) {
+
+	icon := []byte{0x00, 0x00, 0x01, 0x00, 0x01, 0x00}
+	lmux := NewLightMux(&http.Server{})
+	lmux.Robots(RobotsPolicy{
+		Rules:    []RobotsRule{{Disallow: []string{"/admin"}}},
+		Sitemaps: []string{"https://example.com/sitemap.xml"},
+	})
+	lmux.Favicon(fstest.MapFS{"static/favicon.ico": {Data: icon}}, "static/favicon.ico", 0)
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	want := "User-agent: *\nDisallow: /admin\n\nSitemap: https://example.com/sitemap.xml\n"
+	if w.Body.String() != want || w.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Fatalf("unexpected robots.txt: %q %v", w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/x-icon" {
+		t.Fatalf("unexpected favicon response: %d %v", w.Code, w.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching ETag, got %d", w.Code)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.SetErrorEncoder(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		w.WriteHeader(status)
+		w.Write([]byte("timeout: " + err.Error()))
+	})
+	slow := lmux.NewGroup("/slow", Timeout(TimeoutConfig{Timeout: 10 * time.Millisecond}))
+	slow.NewRoute("/report").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Write([]byte("late"))
+	})
+	slow.NewRoute("/fast").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow/report", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "timeout: "+http.ErrHandlerTimeout.Error() {
+		t.Fatalf("unexpected timeout response: %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow/fast", nil))
+	if w.Code != http.StatusAccepted || w.Header().Get("X-Fast") != "1" {
+		t.Fatalf("unexpected fast response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestReloadHooks(t *testing.T) {
+
+	allowlist := NewReloadable([]string{"a"})
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnReload(func() error {
+		allowlist.Store([]string{"a", "b"})
+		return nil
+	})
+	lmux.OnReload(func() error {
+		return io.ErrUnexpectedEOF
+	})
+
+	if err := lmux.Reload(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+	if got := allowlist.Load(); len(got) != 2 {
+		t.Fatalf("unexpected reloaded value: %v", got)
+	}
+}
+
+func TestRouteSkipNamedGroupMiddleware(t *testing.T) {
+
+	var called []string
+
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			called = append(called, "auth")
+			next(w, r)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	api := lmux.NewGroup("/api")
+	api.UseNamed("auth", auth)
+	v1 := api.ContinueGroup("/v1")
+
+	status := v1.NewRoute("/status")
+	status.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		called = append(called, "status")
+	})
+	status.Skip("auth")
+	v1.NewRoute("/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		called = append(called, "users")
+	})
+	lmux.ApplyRoutes()
+
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+
+	mustResult := []string{"status", "auth", "users"}
+	for i := range mustResult {
+		if mustResult[i] != called[i] {
+			t.Fatalf("skip call order failed: %s != %s", mustResult[i], called[i])
+		}
+	}
+}
+
+func TestMethodMismatchAsNotFound(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.SetMethodMismatch(RespondNotFound)
+	lmux.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+	})
+	lmux.NewRoute("/admin/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	mismatch := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(mismatch, httptest.NewRequest(http.MethodDelete, "/admin/users", nil))
+	unknown := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(unknown, httptest.NewRequest(http.MethodDelete, "/admin/unknown", nil))
+
+	if mismatch.Code != http.StatusNotFound || mismatch.Header().Get("Allow") != "" {
+		t.Fatalf("unexpected mismatch response: %d %v", mismatch.Code, mismatch.Header())
+	}
+	if mismatch.Body.String() != unknown.Body.String() {
+		t.Fatalf("mismatch and unknown path responses differ: %q != %q", mismatch.Body.String(), unknown.Body.String())
+	}
+}
+
+type testPatchUser struct {
+	Name  string   `json:"name"`
+	Email string   `json:"email,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+func (u *testPatchUser) Validate() error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestApplyPatch(t *testing.T) {
+
+	newRequest := func(contentType, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return req
+	}
+
+	user := testPatchUser{Name: "ann", Email: "ann@example.com", Tags: []string{"a"}}
+	if err := ApplyPatch(newRequest(MergePatchContentType, `{"email":null,"tags":["a","b"]}`), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "" || len(user.Tags) != 2 {
+		t.Fatalf("unexpected merge patch result: %+v", user)
+	}
+
+	patch := `[{"op":"test","path":"/name","value":"ann"},{"op":"add","path":"/tags/0","value":"z"},{"op":"replace","path":"/name","value":"bob"}]`
+	if err := ApplyPatch(newRequest(JSONPatchContentType, patch), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "bob" || user.Tags[0] != "z" || len(user.Tags) != 3 {
+		t.Fatalf("unexpected JSON patch result: %+v", user)
+	}
+
+	var patchErr *PatchError
+	if err := ApplyPatch(newRequest(JSONPatchContentType, `[{"op":"remove","path":"/missing"}]`), &user); !errors.As(err, &patchErr) {
+		t.Fatalf("expected PatchError, got %v", err)
+	}
+	if err := ApplyPatch(newRequest(MergePatchContentType, `{"name":""}`), &user); err == nil || user.Name != "bob" {
+		t.Fatalf("expected validation error and untouched target, got %v %+v", err, user)
+	}
+	if err := ApplyPatch(newRequest(MergePatchContentType, `{"admin":true}`), &user); err == nil {
+		t.Fatal("expected unknown field error")
+	}
+	if err := ApplyPatch(newRequest("application/json", `{}`), &user); !errors.Is(err, ErrUnsupportedPatchType) {
+		t.Fatalf("expected ErrUnsupportedPatchType, got %v", err)
+	}
+}
+
+type testPatchAccount struct {
+	Name         string `json:"name"`
+	Email        string `json:"email,omitempty"`
+	PasswordHash string `json:"-"`
+	version      int
+}
+
+func TestApplyPatchHiddenFields(t *testing.T) {
+
+	newRequest := func(contentType, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPatch, "/accounts/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return req
+	}
+
+	account := testPatchAccount{Name: "ann", Email: "ann@example.com", PasswordHash: "hash", version: 3}
+	if err := ApplyPatch(newRequest(MergePatchContentType, `{"email":null}`), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account != (testPatchAccount{Name: "ann", PasswordHash: "hash", version: 3}) {
+		t.Fatalf("unexpected merge patch result: %+v", account)
+	}
+
+	account.Email = "ann@example.com"
+	if err := ApplyPatch(newRequest(JSONPatchContentType, `[{"op":"replace","path":"","value":{"name":"bob"}}]`), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account != (testPatchAccount{Name: "bob", PasswordHash: "hash", version: 3}) {
+		t.Fatalf("unexpected root replace result: %+v", account)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(SecurityHeaders(DefaultSecurityHeaders()))
+	lmux.NewRoute("/api").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.NewRoute("/widget", WithoutSecurityHeaders("X-Frame-Options", "Content-Security-Policy")).
+		Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/api", nil)
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" ||
+		w.Header().Get("X-Frame-Options") != "DENY" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("unexpected security headers: %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widget", nil))
+	if w.Header().Get("X-Frame-Options") != "" || w.Header().Get("Content-Security-Policy") != "" ||
+		w.Header().Get("Strict-Transport-Security") != "" || w.Header().Get("Referrer-Policy") == "" {
+		t.Fatalf("unexpected widget headers: %v", w.Header())
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+
+	hits := 0
+	cache := NewResponseCache(CacheConfig{VaryHeaders: []string{"Accept-Language"}})
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewRoute("/products", cache.Cache(time.Minute)).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("products " + r.Header.Get("Accept-Language")))
+	})
+	lmux.ApplyRoutes()
+
+	get := func(lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		lmux.Mux().ServeHTTP(w, req)
+		return w
+	}
+
+	get("en")
+	w := get("en")
+	if hits != 1 || w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "products en" {
+		t.Fatalf("expected cache hit, handler hits: %d, response: %q %v", hits, w.Body.String(), w.Header())
+	}
+
+	get("de")
+	cache.Invalidate("/products")
+	get("en")
+	if hits != 3 {
+		t.Fatalf("expected vary miss and invalidation miss, handler hits: %d", hits)
+	}
+}
+
+func TestResponseCacheHeaders(t *testing.T) {
+
+	hits := 0
+	cache := NewResponseCache(CacheConfig{})
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RequestIDMiddleware(RequestIDConfig{}))
+	lmux.NewRoute("/products", cache.Cache(time.Minute)).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("products " + r.Header.Get("Accept-Encoding")))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	get := func(encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("gzip")
+	second := get("gzip")
+	if hits != 1 || second.Header().Get("X-Cache") != "HIT" || second.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("expected cache hit, handler hits: %d, headers: %v", hits, second.Header())
+	}
+	if id := second.Header().Values(DefaultRequestIDHeader); len(id) != 1 || id[0] == first.Header().Get(DefaultRequestIDHeader) {
+		t.Fatalf("cache hit must carry its own request ID, got %v after %q", id, first.Header().Get(DefaultRequestIDHeader))
+	}
+
+	if w := get("br"); hits != 2 || w.Body.String() != "products br" {
+		t.Fatalf("expected Vary miss, handler hits: %d, body: %q", hits, w.Body.String())
+	}
+	if w := get("br"); hits != 2 || w.Body.String() != "products br" {
+		t.Fatalf("expected Vary hit, handler hits: %d, body: %q", hits, w.Body.String())
+	}
+}
+
+func TestResponseCacheSetCookie(t *testing.T) {
+
+	hits := 0
+	cache := NewResponseCache(CacheConfig{})
+	session := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Query().Get("user")})
+			next(w, r)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewRoute("/products", session, cache.Cache(time.Minute)).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("products"))
+	})
+	lmux.ApplyRoutes()
+
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products?user=a", nil))
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products?user=a", nil))
+	if hits != 1 || w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("outer cookies must not prevent caching, handler hits: %d", hits)
+	}
+	if cookies := w.Header().Values("Set-Cookie"); len(cookies) != 1 || cookies[0] != "session=a" {
+		t.Fatalf("unexpected cookies on cache hit: %v", cookies)
+	}
+}
+
+func TestGuard(t *testing.T) {
+
+	var reported error
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/metrics", Guard(GuardConfig{AllowedCIDRs: []string{"10.0.0.0/8"}, BearerToken: "s3cret"})).
+		Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	cases := []struct {
+		remote, auth string
+		want         int
+		err          error
+	}{
+		{"10.1.2.3:5000", "Bearer s3cret", http.StatusOK, nil},
+		{"10.1.2.3:5000", "Bearer wrong", http.StatusUnauthorized, ErrAuthRequired},
+		{"192.168.1.1:5000", "Bearer s3cret", http.StatusForbidden, ErrAccessDenied},
+	}
+	for _, c := range cases {
+		reported = nil
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = c.remote
+		req.Header.Set("Authorization", c.auth)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		if w.Code != c.want || reported != c.err {
+			t.Fatalf("%s %s: expected %d %v, got %d %v", c.remote, c.auth, c.want, c.err, w.Code, reported)
+		}
+	}
+}
+
+func TestRunTLSFallbackHTTP(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.SetTLSFallback(TLSFallback{Mode: TLSFallbackHTTP})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- lmux.RunTLS(ctx, "missing-cert.pem", "missing-key.pem")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("degraded HTTP mode must shut down cleanly, got %v", err)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+
+	var got string
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(RealIP(RealIPConfig{TrustedProxies: []string{"10.0.0.0/8"}}))
+	lmux.NewRoute("/ip").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"10.0.0.1:1234", map[string]string{"X-Real-IP": "203.0.113.8"}, "203.0.113.8"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https`}, "2001:db8::1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.7"}, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Fatalf("remote %s with %v: expected client IP %s, got %s", tt.remote, tt.headers, tt.want, got)
+		}
+	}
+}
+
+func TestDecompressAndAcceptEncodings(t *testing.T) {
+
+	var unsupported int
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) {
+		if errors.Is(err, ErrUnsupportedEncoding) {
+			unsupported++
+		}
+	})
+	lmux.Use(Decompress(DecompressConfig{}))
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}
+	lmux.NewRoute("/events").Handle(http.MethodPost, echo)
+	hooks := lmux.NewGroup("/hooks")
+	hooks.AcceptEncodings(EncodingIdentity)
+	hooks.NewRoute("/stripe").Handle(http.MethodPost, echo)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"ok":true}`))
+	zw.Close()
+
+	send := func(path, encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("/events", "gzip", gz.Bytes()); w.Code != http.StatusOK || w.Body.String() != `{"ok":true}` {
+		t.Fatalf("expected decompressed body, got %d %q", w.Code, w.Body.String())
+	}
+	var zl bytes.Buffer
+	zlw := zlib.NewWriter(&zl)
+	zlw.Write([]byte(`{"ok":true}`))
+	zlw.Close()
+	if w := send("/events", "deflate", zl.Bytes()); w.Code != http.StatusOK || w.Body.String() != `{"ok":true}` {
+		t.Fatalf("expected decompressed deflate body, got %d %q", w.Code, w.Body.String())
+	}
+	if w := send("/events", "br", []byte("x")); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for unsupported encoding, got %d", w.Code)
+	}
+	w := send("/hooks/stripe", "gzip", gz.Bytes())
+	if w.Code != http.StatusUnsupportedMediaType || w.Header().Get("Accept-Encoding") != "identity" {
+		t.Fatalf("expected 415 with Accept-Encoding identity, got %d %q", w.Code, w.Header().Get("Accept-Encoding"))
+	}
+	if w := send("/hooks/stripe", "", []byte("raw")); w.Code != http.StatusOK || w.Body.String() != "raw" {
+		t.Fatalf("expected identity body to pass, got %d %q", w.Code, w.Body.String())
+	}
+	if unsupported != 2 {
+		t.Fatalf("expected 2 ErrUnsupportedEncoding reports, got %d", unsupported)
+	}
+}
+
+func TestSessions(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(Sessions(SessionConfig{}))
+	lmux.NewRoute("/login").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		s := Session(r)
+		s.Set("user", "alice")
+		if err := s.RenewID(); err != nil {
+			t.Fatalf("renew: %v", err)
+		}
+	})
+	lmux.NewRoute("/me").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if user, _ := Session(r).Get("user").(string); user != "" {
+			w.Write([]byte(user))
+		}
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Value == "" {
+		t.Fatalf("expected HttpOnly session cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Body.String() != "alice" {
+		t.Fatalf("expected session value alice, got %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "lightmux_session", Value: "attacker-chosen"})
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Body.Len() != 0 {
+		t.Fatalf("unknown session ID must start an empty session, got %q", w.Body.String())
+	}
+}
+
+func TestTLSInfo(t *testing.T) {
+
+	var info *TLSConnInfo
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewRoute("/tls").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		info = TLSInfo(r)
+	})
+	lmux.ApplyRoutes()
+
+	srv := httptest.NewUnstartedServer(lmux.Mux())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/tls")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if info == nil || info.VersionName != "TLS 1.3" || info.NegotiatedProtocol != "h2" || info.CipherSuiteName == "" {
+		t.Fatalf("unexpected TLS info: %+v", info)
+	}
+
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tls", nil))
+	if info != nil {
+		t.Fatalf("expected nil TLS info for plain HTTP, got %+v", info)
+	}
+}
+
+func TestConditionalMiddleware(t *testing.T) {
+
+	deny := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(Unless(PathPrefix("/healthz", "/static/"), deny))
+	lmux.Use(Only(MethodIs(http.MethodDelete), deny))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	lmux.NewRoute("/healthz").Handle(http.MethodGet, ok)
+	lmux.NewRoute("/static/app.js").Handle(http.MethodDelete, ok)
+	lmux.NewRoute("/api").Handle(http.MethodGet, ok)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/healthz", http.StatusOK},
+		{http.MethodGet, "/api", http.StatusUnauthorized},
+		{http.MethodDelete, "/static/app.js", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestReplaceDuplicateRoutes(t *testing.T) {
+
+	var logs bytes.Buffer
+	lmux := New(WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	lmux.SetDuplicateRoutes(ReplaceDuplicates)
+
+	lmux.NewRoute("/plugin").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1"))
+	})
+	lmux.NewRoute("/plugin").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v2"))
+	})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugin", nil))
+	if w.Body.String() != "v2" {
+		t.Fatalf("expected replaced handler, got %q", w.Body.String())
+	}
+	if !strings.Contains(logs.String(), `"msg":"Route registered again, replaced its middlewares","path":"/plugin"`) ||
+		!strings.Contains(logs.String(), `"msg":"Route registered again, replaced its handler","method":"GET","path":"/plugin"`) {
+		t.Fatalf("expected the replacements in the configured logger, got %q", logs.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on duplicate route by default")
+		}
+	}()
+	strict := NewLightMux(&http.Server{})
+	strict.NewRoute("/plugin")
+	strict.NewRoute("/plugin")
+}
+
+type probeWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *probeWriter) Header() http.Header         { return w.header }
+func (w *probeWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *probeWriter) WriteHeader(status int)      { w.status = status }
+
+func TestProbeFastPath(t *testing.T) {
+
+	var ready atomic.Bool
+	var middlewareCalls atomic.Int32
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			middlewareCalls.Add(1)
+			next(w, r)
+		}
+	})
+	lmux.Probe("/healthz", nil)
+	lmux.Probe("/readyz", ready.Load)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	w := &probeWriter{header: make(http.Header)}
+	req := httptest.NewRequest(http.MethodHead, "/healthz", nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		lmux.server.Handler.ServeHTTP(w, req)
+	})
+	if allocs != 0 || w.status != http.StatusOK || middlewareCalls.Load() != 0 {
+		t.Fatalf("expected allocation-free 200 bypassing middlewares, got %v allocs, status %d, %d middleware calls",
+			allocs, w.status, middlewareCalls.Load())
+	}
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while not ready, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed || middlewareCalls.Load() != 1 {
+		t.Fatalf("expected POST to take the regular path and get 405, got %d", rec.Code)
+	}
+}
+
+func TestGlobalUseNamedSkip(t *testing.T) {
+
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.UseNamed("auth", auth)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	lmux.NewRoute("/profile").Handle(http.MethodGet, ok)
+	login := lmux.NewRoute("/login")
+	login.Handle(http.MethodPost, ok)
+	login.Skip("auth")
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected named middleware to protect /profile, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected /login to skip auth, got %d", w.Code)
+	}
+}
+
+func TestExplainRoute(t *testing.T) {
+
+	mw := func(next http.HandlerFunc) http.HandlerFunc { return next }
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(mw)
+	lmux.UseNamed("auth", mw)
+	api := lmux.NewGroup("/api", mw)
+	api.UseNamed("audit", mw)
+	users := api.NewRoute("/users/{id}", mw)
+	users.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	users.Skip("audit")
+
+	e, err := lmux.ExplainRoute("/api/users/42", http.MethodGet)
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+
+	var got []string
+	for _, link := range e.Chain {
+		s := link.Source + ":" + link.Name
+		if link.Skipped {
+			s += ":skipped"
+		}
+		got = append(got, s)
+	}
+	want := "global:,named:auth,group /api:,group /api:audit:skipped,route:,handler:"
+	if e.Pattern != "/api/users/{id}" || strings.Join(got, ",") != want {
+		t.Fatalf("unexpected chain for %s:\n%s", e.Pattern, e)
+	}
+
+	if _, err := lmux.ExplainRoute("/api/users/42", http.MethodDelete); err == nil {
+		t.Fatalf("expected error for unregistered method")
+	}
+}
+
+func TestUseWithPriority(t *testing.T) {
+
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(mark("default"))
+	lmux.UseWithPriority(PhaseAuth, mark("auth"))
+	lmux.UseWithPriority(PhasePreRouting, mark("logger"))
+	lmux.UseWithPriority(PhaseAuth, mark("authz"))
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "logger,auth,authz,default" {
+		t.Fatalf("unexpected middleware order: %s", got)
+	}
+}
+
+func TestWrapStd(t *testing.T) {
+
+	std := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Std", r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.UseStd(std)
+	lmux.NewRoute("/std", WrapStd(std)).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/std", nil))
+	if got := w.Header().Values("X-Std"); len(got) != 2 {
+		t.Fatalf("expected std middleware to run globally and on the route, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	ToStd(WrapStd(std))(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if w.Header().Get("X-Std") != "/x" || w.Code != http.StatusNotFound {
+		t.Fatalf("ToStd round trip failed: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestGroupDefaultContentType(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	api := lmux.NewGroup("/api")
+	api.DefaultContentType("application/json")
+	api.NewRoute("/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	api.NewRoute("/export").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("a,b\n"))
+	})
+	api.NewRoute("/empty").Handle(http.MethodDelete, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	lmux.ApplyRoutes()
+
+	for path, want := range map[string]string{"/api/users": "application/json", "/api/export": "text/csv"} {
+		w := httptest.NewRecorder()
+		lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := w.Header().Get("Content-Type"); got != want {
+			t.Fatalf("%s: expected Content-Type %s, got %s", path, want, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/empty", nil))
+	if got := w.Header().Get("Content-Type"); got != "" {
+		t.Fatalf("expected no Content-Type for 204, got %s", got)
+	}
+}
+
+type testGorillaMiddleware struct{}
+
+func (testGorillaMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Chain", "gorilla")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestThirdPartyAdapters(t *testing.T) {
+
+	negroni := NegroniFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		w.Header().Add("X-Chain", "negroni")
+		next(w, r)
+	})
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewRoute("/", WrapNegroni(negroni), WrapGorilla(testGorillaMiddleware{})).
+		Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "negroni,gorilla" {
+		t.Fatalf("unexpected adapter chain: %s", got)
+	}
+}
+
+func TestHeaderLimits(t *testing.T) {
+
+	var stats HeaderStats
+	var reported error
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/", HeaderLimits(HeaderLimitsConfig{MaxFieldBytes: 64, MaxFields: 3})).
+		Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			stats, _ = RequestHeaderStats(r)
+		})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header = http.Header{"Accept": {"*/*"}}
+	w := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || stats.Count != 1 || stats.Bytes != len("Accept: */*\r\n") {
+		t.Fatalf("unexpected stats %+v (status %d)", stats, w.Code)
+	}
+
+	req.Header.Set("Cookie", strings.Repeat("a", 100))
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestHeaderFieldsTooLarge || !errors.Is(reported, ErrHeaderFieldTooLarge) ||
+		!strings.Contains(w.Body.String(), "request header field too large: Cookie") {
+		t.Fatalf("expected 431 for oversized field, got %d %q %v", w.Code, w.Body.String(), reported)
+	}
+
+	req.Header.Set("Cookie", "a")
+	req.Header.Set("X-A", "1")
+	req.Header.Set("X-B", "2")
+	w = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestHeaderFieldsTooLarge || reported != ErrTooManyHeaderFields {
+		t.Fatalf("expected 431 for too many fields, got %d %v", w.Code, reported)
+	}
+}
+
+func TestMiddlewareStack(t *testing.T) {
+
+	mark := func(name string) Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Chain", name)
+				next(w, r)
+			}
+		}
+	}
+
+	base := NewStack(mark("a"), mark("b"))
+	admin := base.Append(mark("admin"))
+	public := base.Append(mark("public"))
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewGroup("/admin", admin.Middlewares()...).NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.NewRoute("/public", public.Middleware()).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	for path, want := range map[string]string{"/admin/": "a,b,admin", "/public": "a,b,public"} {
+		w := httptest.NewRecorder()
+		lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := strings.Join(w.Header().Values("X-Chain"), ","); got != want {
+			t.Fatalf("%s: expected chain %s, got %s", path, want, got)
+		}
+	}
+	if base.Len() != 2 {
+		t.Fatalf("Append must not modify the base stack, got %d middlewares", base.Len())
+	}
+}
+
+func TestRunnerLifecycle(t *testing.T) {
+
+	var stopped []string
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	worker := FuncComponent{StopFunc: func(ctx context.Context) error {
+		stopped = append(stopped, "worker")
+		return nil
+	}}
+	lmux.onStop(func(ctx context.Context) error {
+		stopped = append(stopped, "http")
+		return nil
+	})
+
+	runner := NewRunner()
+	runner.Add("worker", worker)
+	runner.Add("http", lmux.Component())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("runner failed: %v", err)
+	}
+	if got := strings.Join(stopped, ","); got != "worker,http" && got != "http,worker" {
+		t.Fatalf("expected both components to stop, got %s", got)
+	}
+
+	failing := NewRunner()
+	failing.Add("broken", FuncComponent{StartFunc: func(ctx context.Context) error { return errors.New("boom") }})
+	failing.Add("idle", FuncComponent{})
+	if err := failing.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "broken: boom") {
+		t.Fatalf("expected component failure to stop the runner, got %v", err)
+	}
+}
+
+func TestAfterHooks(t *testing.T) {
+
+	var got ResponseInfo
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.After(func(r *http.Request, res ResponseInfo) {
+		got = res
+	})
+	lmux.NewRoute("/items/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+	if got.Status != http.StatusAccepted || got.Bytes != 5 || got.Route != "/items/{id}" || got.Duration <= 0 {
+		t.Fatalf("unexpected response info: %+v", got)
+	}
+}
+
+func TestAfterHooksHijack(t *testing.T) {
+
+	statuses := make(chan int, 1)
+	lmux := NewLightMux(&http.Server{})
+	lmux.After(func(r *http.Request, res ResponseInfo) { statuses <- res.Status })
+	lmux.NewRoute("/ws").Handle(http.MethodGet, hijackHandler)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	assertHijack(t, lmux.server.Handler, "/ws")
+	if status := <-statuses; status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the hijacked request to be reported as 101, got %d", status)
+	}
+}
+
+func TestRouteCORSTuning(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(CORS(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: time.Minute, RouteMethods: true}))
+	hot := lmux.NewRoute("/feed")
+	hot.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	hot.CORS(RouteCORS{MaxAge: 2 * time.Hour, AllowedHeaders: []string{"Authorization"}})
+	lmux.NewRoute("/other").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	preflight := func(path string) http.Header {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	h := preflight("/feed")
+	if h.Get("Access-Control-Max-Age") != "7200" || h.Get("Access-Control-Allow-Methods") != "GET" || h.Get("Access-Control-Allow-Headers") != "Authorization" {
+		t.Fatalf("unexpected tuned preflight headers: %v", h)
+	}
+
+	h = preflight("/other")
+	if h.Get("Access-Control-Max-Age") != "60" || h.Get("Access-Control-Allow-Methods") != "POST" {
+		t.Fatalf("unexpected default preflight headers: %v", h)
+	}
+}
+
+func TestErrorReturningChain(t *testing.T) {
+
+	var reported int
+
+	requireAdmin := func(next ErrorHandlerFunc) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if r.Header.Get("X-Role") != "admin" {
+				return StatusError(http.StatusForbidden, errors.New("admin only"))
+			}
+			return next(w, r)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) {
+		reported = status
+	})
+	lmux.NewRoute("/admin").HandleE(http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("database down")
+	}, requireAdmin)
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if w.Code != http.StatusForbidden || w.Body.String() != "{\"error\":\"admin only\"}\n" {
+		t.Fatalf("unexpected middleware error response: %d %q", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-Role", "admin")
+	w = httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || reported != http.StatusInternalServerError {
+		t.Fatalf("expected 500 reported through hooks, got %d (reported %d)", w.Code, reported)
+	}
+}
+
+func TestSLOBurnHook(t *testing.T) {
+
+	var alerts []SLOStatus
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnSLOBurn(func(status SLOStatus) {
+		alerts = append(alerts, status)
+	})
+	checkout := lmux.NewRoute("/checkout")
+	checkout.SetSLO(SLO{Objective: 0.9, MinRequests: 10})
+	checkout.Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	lmux.ApplyRoutes()
+
+	serve := func(target string) {
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	for range 10 {
+		serve("/checkout")
+	}
+	for range 5 {
+		serve("/checkout?fail")
+	}
+
+	status := lmux.SLOStatus()
+	if len(status) != 1 || status[0].Total != 15 || status[0].Bad != 5 {
+		t.Fatalf("unexpected SLO status: %+v", status)
+	}
+	if len(alerts) != 1 || alerts[0].Route != "/checkout" || alerts[0].BurnRate <= 2 {
+		t.Fatalf("expected one burn alert, got %+v", alerts)
+	}
+}
+
+func TestErrorRateWatchdog(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	var alerts []ErrorRateAlert
+	lmux.OnErrorRate(ErrorRateConfig{Threshold: 0.2, MinRequests: 10, Routes: []string{"/pay"}}, func(a ErrorRateAlert) {
+		alerts = append(alerts, a)
+	})
+	fail := true
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	lmux.NewRoute("/pay").Handle(http.MethodPost, handler)
+	lmux.NewRoute("/other").Handle(http.MethodPost, handler)
+	lmux.ApplyRoutes()
+
+	serve := func(path string, n int) {
+		for range n {
+			lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+		}
+	}
+	serve("/other", 20)
+	serve("/pay", 10)
+	if len(alerts) != 1 || alerts[0].Route != "/pay" || alerts[0].Total != 10 || alerts[0].Rate != 1 || alerts[0].Recovered {
+		t.Fatalf("expected one alert for /pay, got %+v", alerts)
+	}
+
+	fail = false
+	serve("/pay", 40)
+	if len(alerts) != 2 || !alerts[1].Recovered || alerts[1].Rate > 0.2 {
+		t.Fatalf("expected a recovery alert, got %+v", alerts)
+	}
+}
+
+func TestRouteStats(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableStats()
+	users := lmux.NewRoute("/users/{id}")
+	users.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	})
+	lmux.NewRoute("/ws").Handle(http.MethodGet, hijackHandler)
+	lmux.ApplyRoutes()
+
+	for _, id := range []string{"1", "2", "0"} {
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/"+id, nil))
+	}
+
+	// observability must not change handler behavior, e.g. WebSocket upgrades
+	assertHijack(t, lmux.Mux(), "/ws")
+	// the handler closes the connection before the observers run
+	deadline := time.Now().Add(2 * time.Second)
+	for ws := lmux.RouteStats()[1]; ws.Status1xx != 1; ws = lmux.RouteStats()[1] {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the upgrade to be counted as 1xx, got %+v", ws)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, s := range lmux.Stats() {
+		if s.Method != http.MethodGet {
+			continue
+		}
+		if s.Route != "/users/{id}" || s.Total != 3 || s.Status2xx != 2 || s.Status5xx != 1 {
+			t.Fatalf("unexpected stats: %+v", s)
+		}
+		return
+	}
+	t.Fatalf("no GET stats recorded: %+v", lmux.Stats())
+}
+
+func TestAdminGuardAppliedLate(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableMetrics("/metrics")
+	lmux.EnablePprof("/debug/pprof")
+	lmux.EnableVersionEndpoint("/version", BuildInfo{})
+	lmux.SetAdminGuard(GuardConfig{BearerToken: "secret"})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for _, path := range []string{"/metrics", "/debug/pprof/", "/version"} {
+		rec := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected the admin guard set afterwards to apply, got %d", path, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected authorized access, got %d", rec.Code)
+	}
+}
+
+func TestEnableMetrics(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.SetAdminGuard(GuardConfig{BearerToken: "secret"})
+	lmux.EnableMetrics("/metrics")
+	users := lmux.NewRoute("/users/{id}")
+	users.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for _, id := range []string{"1", "2", "0"} {
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/"+id, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the admin guard to protect metrics, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{
+		`lightmux_http_requests_in_flight 1`,
+		`lightmux_http_requests_total{route="/users/{id}",method="GET",status="2xx"} 2`,
+		`lightmux_http_requests_total{route="/users/{id}",method="GET",status="5xx"} 1`,
+		`lightmux_http_request_duration_seconds_bucket{route="/users/{id}",method="GET",status="2xx",le="+Inf"} 2`,
+		`lightmux_http_response_size_bytes_sum{route="/users/{id}",method="GET",status="2xx"} 10`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "/users/1") {
+		t.Fatalf("raw paths must not be labels:\n%s", body)
+	}
+}
+
+func TestMetricsSinks(t *testing.T) {
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer pc.Close()
+
+	statsd, err := NewStatsDSink(StatsDConfig{Addr: pc.LocalAddr().String(), Prefix: "api", Tags: true})
+	if err != nil {
+		t.Fatalf("creating statsd sink failed: %v", err)
+	}
+	defer statsd.Close()
+
+	var observed []RequestMetric
+	lmux := NewLightMux(&http.Server{})
+	lmux.AddMetricsSink(statsd)
+	lmux.AddMetricsSink(MetricsSinkFunc(func(m RequestMetric) { observed = append(observed, m) }))
+	lmux.NewRoute("/users/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	lmux.ApplyRoutes()
+
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if len(observed) != 1 || observed[0].Route != "/users/{id}" || observed[0].Status != http.StatusOK || observed[0].Bytes != 5 {
+		t.Fatalf("unexpected measurements: %+v", observed)
+	}
+
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no statsd packet received: %v", err)
+	}
+	packet := string(buf[:n])
+	for _, want := range []string{
+		"api.requests:1|c|#route:/users/{id},method:GET,status:2xx",
+		"api.response_size:5|h|#route:/users/{id},method:GET,status:2xx",
+	} {
+		if !strings.Contains(packet, want) {
+			t.Fatalf("statsd packet missing %q:\n%s", want, packet)
+		}
+	}
+
+	if name := statsDName("/users/{id}/orders"); name != "users_id_orders" {
+		t.Fatalf("unexpected statsd name: %s", name)
+	}
+}
+
+func TestTrafficStats(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableMetrics("/metrics")
+	lmux.NewRoute("/upload").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	})
+	lmux.NewRoute("/ping").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.NopCloser(strings.NewReader(strings.Repeat("x", 2048))))
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), req)
+
+	stats := lmux.TrafficStats()
+	if len(stats) != 2 || stats[0].Route != "/upload" || stats[0].RequestBytes != 2048 || stats[0].ResponseBytes != 2 ||
+		stats[1].Route != "/ping" || stats[1].TotalBytes() != 0 {
+		t.Fatalf("unexpected traffic stats: %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `lightmux_http_request_size_bytes_sum{route="/upload",method="POST",status="2xx"} 2048`; !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("metrics missing %q:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestLatencyHistograms(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableLatencyHistograms(time.Second, 10*time.Millisecond)
+	lmux.NewRoute("/slow").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("wait") {
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	lmux.ApplyRoutes()
+
+	for range 9 {
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow?wait", nil))
+
+	for _, h := range lmux.LatencyHistograms() {
+		if h.Method != http.MethodGet {
+			continue
+		}
+		if h.Route != "/slow" || h.Count != 10 || h.Counts[0] != 9 || h.Counts[1] != 1 || h.Buckets[0] != 10*time.Millisecond {
+			t.Fatalf("unexpected histogram: %+v", h)
+		}
+		if p50, p99 := h.Quantile(0.5), h.Quantile(0.99); p50 > 10*time.Millisecond || p99 <= 10*time.Millisecond {
+			t.Fatalf("unexpected quantiles p50=%v p99=%v", p50, p99)
+		}
+		return
+	}
+	t.Fatalf("no GET histogram recorded: %+v", lmux.LatencyHistograms())
+}
+
+func TestEnableVersionEndpoint(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.EnableVersionEndpoint("/version", BuildInfo{Version: "v1.2.3"})
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info BuildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("invalid version response: %v", err)
+	}
+	if info.Version != "v1.2.3" || info.GoVersion != runtime.Version() || time.Since(info.StartTime) > time.Minute {
+		t.Fatalf("unexpected build info: %+v", info)
+	}
+}
+
+func TestEnableStatusEndpoint(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.EnableStatusEndpoint("/status", Guard(GuardConfig{BearerToken: "secret"}))
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the status endpoint to be protected, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+
+	var status ServerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status response: %v", err)
+	}
+	if status.Uptime == "" || status.Goroutines == 0 || status.Memory.Sys == 0 || status.InFlight != 1 || status.Draining {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestEnableExpvar(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.Use(func(next http.HandlerFunc) http.HandlerFunc { return next })
+	lmux.EnableExpvar("/debug/vars")
+	lmux.NewRoute("/users").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	var vars struct {
+		LightMux map[string]struct {
+			Uptime float64                 `json:"uptime_seconds"`
+			Routes map[string]*expvarRoute `json:"routes"`
+		} `json:"lightmux"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("invalid expvar output: %v", err)
+	}
+	stats, ok := vars.LightMux["127.0.0.1:0"]
+	if !ok || stats.Uptime <= 0 {
+		t.Fatalf("expected uptime of the server, got %+v", vars.LightMux)
+	}
+	users := stats.Routes["/users"]
+	if users == nil || users.Middlewares != 1 || users.Requests[http.MethodGet]["2xx"] != 1 {
+		t.Fatalf("unexpected route stats: %+v", users)
+	}
+}
+
+func TestEnableDebugUI(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableDebugUI("/_lightmux", Guard(GuardConfig{BearerToken: "secret"}))
+	lmux.NewRoute("/orders").Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusConflict, errors.New("order <42> already exists"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", nil))
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_lightmux", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the debug UI to be protected, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_lightmux", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{"<td>/orders</td>", "[route] github.com/ayayaakasvin/lightmux.Guard", "order &lt;42&gt; already exists", "<td>409</td>"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("debug UI missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestEnablePprof(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnablePprof("/admin/pprof", Guard(GuardConfig{BearerToken: "secret"}))
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	if _, ok := lmux.routeMap["/admin/pprof/{profile}"]; !ok {
+		t.Fatal("expected pprof handlers in the route table")
+	}
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/pprof/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected pprof to be protected, got %d", rec.Code)
+	}
+
+	for path, want := range map[string]string{
+		"/admin/pprof/":                  "goroutine",
+		"/admin/pprof/goroutine?debug=1": "goroutine profile:",
+		"/admin/pprof/cmdline":           os.Args[0],
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("%s: unexpected response %d: %.200s", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRouteHitStats(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableStats()
+	users := lmux.NewRoute("/users")
+	users.Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	users.Handle(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	lmux.NewRoute("/legacy").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+
+	before := time.Now()
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	stats := lmux.RouteStats()
+	if len(stats) != 2 {
+		t.Fatalf("expected stats of both routes, got %+v", stats)
+	}
+	legacy, hit := stats[0], stats[1]
+	if legacy.Route != "/legacy" || legacy.Total != 0 || !legacy.LastHit.IsZero() {
+		t.Fatalf("expected /legacy to be unused, got %+v", legacy)
+	}
+	if hit.Route != "/users" || hit.Total != 2 || hit.Status2xx != 1 || hit.Status4xx != 1 || hit.LastHit.Before(before) {
+		t.Fatalf("unexpected /users stats: %+v", hit)
+	}
+}
+
+func TestRouterEvents(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	var events []string
+	lmux.OnRouterEvent(func(e RouterEvent) {
+		events = append(events, fmt.Sprintf("%s %s %d", e.Kind, e.Route, e.Status))
+	})
+	lmux.NewRoute("/users/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/1", nil),
+		httptest.NewRequest(http.MethodDelete, "/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+	} {
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := "route-matched /users/{id} 0,handler-completed /users/{id} 202,method-not-allowed /users/{id} 0,not-found  0"
+	if got := strings.Join(events, ","); got != want {
+		t.Fatalf("unexpected events:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestRouterEventsHijack(t *testing.T) {
+
+	events := make(chan RouterEvent, 2)
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnRouterEvent(func(e RouterEvent) { events <- e })
+	lmux.NewRoute("/ws").Handle(http.MethodGet, hijackHandler)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	assertHijack(t, lmux.server.Handler, "/ws")
+	<-events
+	if completed := <-events; completed.Kind != EventHandlerCompleted || completed.Status != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected completion event: %+v", completed)
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	var recovered any
+	var stack []byte
+	lmux.OnPanic(func(r *http.Request, p any, s []byte) {
+		recovered, stack = p, s
+	})
+	var reported error
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = err })
+	lmux.NewRoute("/boom").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "boom") {
+		t.Fatalf("expected a 500 without panic details, got %d %s", rec.Code, rec.Body.String())
+	}
+	if recovered != "boom" || !bytes.Contains(stack, []byte("TestOnPanic")) {
+		t.Fatalf("unexpected panic report: %v\n%s", recovered, stack)
+	}
+	if reported == nil || reported.Error() != "panic: boom" {
+		t.Fatalf("expected the panic to be reported as an error, got %v", reported)
+	}
+}
+
+func TestOnPanicAfterPartialWrite(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnPanic(func(r *http.Request, p any, s []byte) {})
+	var reported int
+	lmux.OnError(func(r *http.Request, status int, err error) { reported = status })
+	lmux.NewRoute("/stream").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if rec.Code != http.StatusAccepted || rec.Body.String() != "partial" {
+		t.Fatalf("expected the partial response untouched, got %d %q", rec.Code, rec.Body.String())
+	}
+	if reported != http.StatusInternalServerError {
+		t.Fatalf("expected the panic to be reported, got status %d", reported)
+	}
+}
+
+// hijackHandler upgrades the connection the way WebSocket libraries do, asserting http.Hijacker.
+func hijackHandler(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\nupgraded")
+	buf.Flush()
+}
+
+// assertHijack sends an upgrade request to handler on a real server and fails unless the connection was hijacked.
+func assertHijack(t *testing.T, handler http.Handler, path string) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", path)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := io.ReadAll(conn)
+	if !strings.HasPrefix(string(resp), "HTTP/1.1 101 Switching Protocols") || !strings.HasSuffix(string(resp), "upgraded") {
+		t.Fatalf("expected a hijacked connection, got %q (%v)", resp, err)
+	}
+}
+
+func TestOnPanicHijack(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnPanic(func(r *http.Request, p any, s []byte) {})
+	lmux.NewRoute("/ws").Handle(http.MethodGet, hijackHandler)
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	assertHijack(t, lmux.server.Handler, "/ws")
+}
+
+func TestAccessLogFormats(t *testing.T) {
+
+	var common, combined, jsonLines bytes.Buffer
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(
+		AccessLog(AccessLogConfig{Output: &common}),
+		AccessLog(AccessLogConfig{Output: &combined, Format: CombinedLogFormat}),
+		AccessLog(AccessLogConfig{Output: &jsonLines, Format: JSONLogFormat}),
+	)
+	lmux.NewRoute("/docs/{name}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/intro?lang=en", nil)
+	req.RemoteAddr = "192.0.2.10:5000"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", "curl/8.0")
+	lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasPrefix(common.String(), "192.0.2.10 - - [") || !strings.HasSuffix(common.String(), `] "GET /docs/intro?lang=en HTTP/1.1" 200 5`+"\n") {
+		t.Fatalf("unexpected common log line: %q", common.String())
+	}
+	if !strings.HasSuffix(combined.String(), `200 5 "https://example.com/" "curl/8.0"`+"\n") {
+		t.Fatalf("unexpected combined log line: %q", combined.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(jsonLines.Bytes(), &entry); err != nil || entry["route"] != "/docs/{name}" || entry["bytes"] != float64(5) {
+		t.Fatalf("unexpected JSON log line %q: %v", jsonLines.String(), err)
+	}
+}
+
+func TestRotatingAsyncAccessLog(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := NewRotatingFile(RotatingFileConfig{Path: path, MaxSize: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := NewAsyncWriter(file, 0)
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(AccessLog(AccessLogConfig{Output: out}))
+	lmux.NewRoute("/ping").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for range 10 {
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if _, err := out.Write([]byte("late")); err == nil {
+		t.Fatalf("expected write after close to fail")
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", backups)
+	}
+	for _, name := range append(backups, path) {
+		data, err := os.ReadFile(name)
+		if err != nil || len(data) == 0 || len(data) > 100 || !strings.HasSuffix(string(data), "200 4\n") {
+			t.Fatalf("unexpected log file %s: %q %v", name, data, err)
+		}
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := NewRotatingFile(RotatingFileConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	// Removing the active file makes the rename of the rotation fail.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := file.Rotate(); err == nil {
+		t.Fatalf("expected rotate error")
+	}
+	if _, err := file.Write([]byte("still logging\n")); err != nil {
+		t.Fatalf("expected writes to continue after failed rotation, got %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "still logging\n" {
+		t.Fatalf("unexpected log file: %q %v", data, err)
+	}
+}
+
+func TestLoadShedder(t *testing.T) {
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.NewRoute("/work", LoadShedder(LoadShedConfig{MaxInFlight: 1, MaxWait: 10 * time.Millisecond})).
+		Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		})
+	lmux.ApplyRoutes()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lmux.Mux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 503 with Retry-After while saturated, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	<-done
+}
+
+func TestUserAgentFilter(t *testing.T) {
+
+	var blocked int
+	lmux := NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) {
+		if err == ErrUserAgentBlocked {
+			blocked++
+		}
+	})
+	lmux.Use(UserAgentFilter(UserAgentFilterConfig{
+		Block:      []string{`bot`, `^python-requests/`},
+		Allow:      []string{`Googlebot`},
+		BlockEmpty: true,
+	}))
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	for ua, want := range map[string]int{
+		"Mozilla/5.0":                 http.StatusOK,
+		"python-requests/2.31":        http.StatusForbidden,
+		"EvilBot/1.0":                 http.StatusForbidden,
+		"Mozilla/5.0 (Googlebot/2.1)": http.StatusOK,
+		"":                            http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("User-Agent %q: expected %d, got %d", ua, want, w.Code)
+		}
+	}
+	if blocked != 3 {
+		t.Fatalf("expected 3 ErrUserAgentBlocked reports, got %d", blocked)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+
+	acme := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("token"))
+	})
+	redirect := HTTPSRedirect(HTTPSRedirectConfig{HTTPSPort: "8443", ACMEHandler: acme})(func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	redirect(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/docs?page=2", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://example.com:8443/docs?page=2" {
+		t.Fatalf("unexpected redirect: %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	for host, want := range map[string]string{"[::1]": "https://[::1]:8443/", "[::1]:8080": "https://[::1]:8443/"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		w = httptest.NewRecorder()
+		redirect(w, req)
+		if w.Header().Get("Location") != want {
+			t.Fatalf("%s: expected %q, got %q", host, want, w.Header().Get("Location"))
+		}
+	}
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "[::1]"
+	HTTPSRedirect(HTTPSRedirectConfig{})(func(w http.ResponseWriter, r *http.Request) {})(w, req)
+	if w.Header().Get("Location") != "https://[::1]/" {
+		t.Fatalf("unexpected IPv6 redirect: %q", w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	redirect(w, httptest.NewRequest(http.MethodPost, "http://example.com/form", nil))
+	if w.Code != http.StatusPermanentRedirect {
+		t.Fatalf("expected 308 for POST, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	redirect(w, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/abc", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "token" {
+		t.Fatalf("expected ACME challenge to be served, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRewrite(t *testing.T) {
+
+	var seen, original string
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.Use(Rewrite(
+		StripHeaderPrefix("X-Forwarded-Prefix"),
+		RegexRewrite(`^/legacy/user\.php/(\d+)$`, "/users/$1"),
+		WhenHeader("X-Api-Version", "2", StripPrefix("/api")),
+	))
+	lmux.NewRoute("/users/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		seen, original = r.PathValue("id"), OriginalPath(r)
+	})
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{"/legacy/user.php/7", nil, "7"},
+		{"/shop/users/8", map[string]string{"X-Forwarded-Prefix": "/shop/"}, "8"},
+		{"/api/users/9", map[string]string{"X-Api-Version": "2"}, "9"},
+	}
+	for _, tt := range tests {
+		seen = ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		lmux.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != tt.want || original != tt.path {
+			t.Fatalf("%s: expected id %s and original path kept, got %q %q", tt.path, tt.want, seen, original)
+		}
+	}
+}
+
+func TestStripPrefixSegments(t *testing.T) {
+
+	strip := StripPrefix("/v1")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/v1")
+	for path, want := range map[string]string{
+		"/v1/users":  "/users",
+		"/v1":        "",
+		"/v10/users": "-",
+		"/v1beta":    "-",
+	} {
+		for _, rule := range []RewriteRule{strip, StripHeaderPrefix("X-Forwarded-Prefix")} {
+			got, ok := rule(req, path)
+			if !ok {
+				got = "-"
+			}
+			if got != want {
+				t.Fatalf("%s: expected %q, got %q", path, want, got)
+			}
+		}
+	}
+}
+
+func TestShutdownStopsRun(t *testing.T) {
+
+	var hookCalled atomic.Bool
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.onStop(func(ctx context.Context) error {
+		hookCalled.Store(true)
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("Run must return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+	if !hookCalled.Load() {
+		t.Fatal("stop hooks were not run")
+	}
+	if err := lmux.Close(); err != nil {
+		t.Fatalf("Close after Shutdown must be a no-op, got %v", err)
+	}
+}
+
+func TestSetShutdownTimeout(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.SetShutdownTimeout(time.Minute)
+
+	deadlineCh := make(chan time.Duration, 1)
+	lmux.onStop(func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		deadlineCh <- time.Until(deadline)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if remaining := <-deadlineCh; remaining <= DefaultShutdownTimeout || remaining > time.Minute {
+		t.Fatalf("expected shutdown deadline of about a minute, got %v", remaining)
+	}
+
+	lmux.SetShutdownTimeout(0)
+	if lmux.shutdownTimeout != DefaultShutdownTimeout {
+		t.Fatalf("expected default timeout, got %v", lmux.shutdownTimeout)
+	}
+}
+
+func TestRunReturnsErrors(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	lmux := NewLightMux(&http.Server{Addr: ln.Addr().String()})
+	if err := lmux.Run(context.Background()); err == nil {
+		t.Fatal("expected bind error for a used port")
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+
+	lmux = NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.RunTLS(context.Background(), certFile, keyFile) }()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected error for invalid TLS files")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunTLS did not return for invalid TLS files")
+	}
+}
+
+func TestRunnerSignals(t *testing.T) {
+
+	runner := NewRunner().WithSignals(syscall.SIGHUP)
+	runner.Add("idle", FuncComponent{})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner.Run(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("sending signals is not supported: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("runner failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runner did not stop on a configured signal")
+	}
+
+	if runner := NewRunner().WithoutSignals(); len(runner.Signals) != 0 {
+		t.Fatalf("expected no signals, got %v", runner.Signals)
+	}
+}
+
+func TestAddListener(t *testing.T) {
+
+	free := func() string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	publicAddr, adminAddr := free(), free()
+
+	lmux := NewLightMux(&http.Server{Addr: publicAddr})
+	lmux.NewRoute("/ping").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	lmux.AddListener(ListenerConfig{
+		Addr: adminAddr,
+		Middlewares: []Middleware{func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Listener", "admin")
+				next(w, r)
+			}
+		}},
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	for addr, want := range map[string]string{publicAddr: "", adminAddr: "admin"} {
+		resp, err := http.Get("http://" + addr + "/ping")
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", addr, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "pong" || resp.Header.Get("X-Listener") != want {
+			t.Fatalf("unexpected response from %s: %q, X-Listener %q", addr, body, resp.Header.Get("X-Listener"))
+		}
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := http.Get("http://" + adminAddr + "/ping"); err == nil {
+		t.Fatal("additional listener still serving after Shutdown")
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key to dir.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key failed: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestRunTLSWithRedirect(t *testing.T) {
+
+	free := func() string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	httpsAddr, httpAddr := free(), free()
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+
+	lmux := NewLightMux(&http.Server{Addr: httpsAddr})
+	lmux.RedirectHTTP(HTTPSRedirectConfig{Addr: httpAddr, HTTPSPort: httpsPort})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.RunTLSWithRedirect(context.Background(), certFile, keyFile) }()
+	time.Sleep(50 * time.Millisecond)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get("http://" + httpAddr + "/path?q=1")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if want := "https://" + httpsAddr + "/path?q=1"; resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+		t.Fatalf("expected redirect to %s, got %d %q", want, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("RunTLSWithRedirect failed: %v", err)
+	}
+	if _, err := client.Get("http://" + httpAddr + "/"); err == nil {
+		t.Fatal("redirect listener still serving after Shutdown")
+	}
+}
+
+func TestRunTLSConfig(t *testing.T) {
+
+	readCert := func() ([]byte, []byte) {
+		certFile, keyFile := writeTestCert(t, t.TempDir())
+		certPEM, _ := os.ReadFile(certFile)
+		keyPEM, _ := os.ReadFile(keyFile)
+		return certPEM, keyPEM
+	}
+	cert, err := NewReloadableCertificate(readCert())
+	if err != nil {
+		t.Fatalf("loading certificate failed: %v", err)
+	}
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	if err := lmux.RunTLSConfig(context.Background(), &tls.Config{}); err == nil {
+		t.Fatal("expected error for TLS config without certificates")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	lmux = NewLightMux(&http.Server{Addr: addr})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- lmux.RunTLSConfig(context.Background(), &tls.Config{GetCertificate: cert.GetCertificate})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	peerCert := func() []byte {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Raw
+	}
+
+	before := peerCert()
+	if err := cert.Update(readCert()); err != nil {
+		t.Fatalf("updating certificate failed: %v", err)
+	}
+	if bytes.Equal(before, peerCert()) {
+		t.Fatal("expected the reloaded certificate to be served")
+	}
+	if err := cert.Update([]byte("invalid"), nil); err == nil {
+		t.Fatal("expected error for invalid certificate")
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("RunTLSConfig failed: %v", err)
+	}
+}
+
+type testCertManager struct {
+	cert *tls.Certificate
+}
+
+func (m *testCertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.cert, nil
+}
+
+func (m *testCertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		w.Write([]byte("token-response"))
+	})
+}
+
+func TestRunAutoCert(t *testing.T) {
+
+	free := func() string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	httpsAddr, httpAddr := free(), free()
+
+	cert, err := tls.LoadX509KeyPair(writeTestCert(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("loading certificate failed: %v", err)
+	}
+
+	var observed atomic.Int32
+	lmux := NewLightMux(&http.Server{Addr: httpsAddr})
+	lmux.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			observed.Add(1)
+			next(w, r)
+		}
+	})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.RedirectHTTP(HTTPSRedirectConfig{Addr: httpAddr})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.RunAutoCert(context.Background(), &testCertManager{cert: &cert}) }()
+	time.Sleep(50 * time.Millisecond)
+
+	resp, err := http.Get("http://" + httpAddr + "/.well-known/acme-challenge/abc")
+	if err != nil {
+		t.Fatalf("challenge request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "token-response" || observed.Load() != 1 {
+		t.Fatalf("expected challenge answered through the router, got %q (middleware calls: %d)", body, observed.Load())
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err = client.Get("https://" + httpsAddr + "/")
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("RunAutoCert failed: %v", err)
+	}
+}
+
+type testHTTP3Server struct {
+	handler http.Handler
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (s *testHTTP3Server) ListenAndServe() error {
+	close(s.started)
+	<-s.done
+	return http.ErrServerClosed
+}
+
+func (s *testHTTP3Server) Shutdown(ctx context.Context) error {
+	close(s.done)
+	return nil
+}
+
+func TestEnableHTTP3(t *testing.T) {
+
+	h3 := &testHTTP3Server{started: make(chan struct{}), done: make(chan struct{})}
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	lmux.EnableHTTP3(HTTP3Config{
+		NewServer: func(handler http.Handler) HTTP3Server {
+			h3.handler = handler
+			return h3
+		},
+		Port:   "8443",
+		MaxAge: time.Hour,
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(context.Background()) }()
+
+	select {
+	case <-h3.started:
+	case <-time.After(time.Second):
+		t.Fatal("HTTP/3 server was not started")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Alt-Svc"); got != `h3=":8443"; ma=3600` {
+		t.Fatalf("unexpected Alt-Svc header: %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/3.0", 3, 0
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	h3.handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "HTTP/3.0" || rec.Header().Get("Alt-Svc") != "" {
+		t.Fatalf("expected HTTP/3 request served without Alt-Svc, got %q %q", rec.Body.String(), rec.Header().Get("Alt-Svc"))
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+func TestInFlightDuringDrain(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	lmux.NewRoute("/slow/{id}").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	go http.Get("http://" + addr + "/slow/1")
+	<-entered
+
+	if lmux.Draining() {
+		t.Fatal("must not be draining before shutdown")
+	}
+	requests := lmux.InFlight()
+	if len(requests) != 1 || requests[0].Route != "/slow/{id}" || requests[0].Path != "/slow/1" || requests[0].Method != http.MethodGet {
+		t.Fatalf("unexpected in-flight requests: %+v", requests)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- lmux.Shutdown(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	if !lmux.Draining() || len(lmux.InFlight()) != 1 {
+		t.Fatalf("expected draining with one in-flight request, got %v %+v", lmux.Draining(), lmux.InFlight())
+	}
+
+	close(release)
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(lmux.InFlight()) != 0 {
+		t.Fatalf("expected no in-flight requests after drain, got %+v", lmux.InFlight())
+	}
+}
+
+func TestInheritedListener(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	if err := lmux.Restart(); err == nil {
+		t.Fatal("expected error when restarting a server that is not running")
+	}
+
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("listener file failed: %v", err)
+	}
+
+	addr := parent.Addr().String()
+	inheritedListener("")
+	inherited.mu.Lock()
+	inherited.files[addr] = f
+	inherited.mu.Unlock()
+
+	ln, err := lmux.listen(addr, "")
+	if err != nil {
+		t.Fatalf("expected the inherited listener, got %v", err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != addr {
+		t.Fatalf("expected listener on %s, got %s", addr, ln.Addr())
+	}
+	if len(lmux.restart.listeners) != 1 || lmux.restart.listeners[0].addr != addr {
+		t.Fatalf("expected the listener to be tracked for restart, got %+v", lmux.restart.listeners)
+	}
+	if ln, err := inheritedListener(addr); ln != nil || err != nil {
+		t.Fatal("an inherited listener must only be used once")
+	}
+}
+
+func TestEnableHealthEndpoints(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	lmux.EnableHealthEndpoints("/healthz", "/readyz")
+	lmux.SetDrainDelay(200 * time.Millisecond)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	status := func(path string) int {
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status("/healthz") != http.StatusOK || status("/readyz") != http.StatusOK {
+		t.Fatal("expected healthy probes while running")
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- lmux.Shutdown(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Fatalf("expected readiness to fail during drain, got %d", got)
+	}
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Fatalf("expected liveness to stay healthy during drain, got %d", got)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+func TestAddHealthCheck(t *testing.T) {
+
+	var dbDown atomic.Bool
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableHealthEndpoints("/healthz", "/readyz")
+	lmux.SetHealthDetails(true)
+	lmux.AddHealthCheck("db", HealthCheckerFunc(func(ctx context.Context) error {
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}))
+	lmux.AddHealthCheck("cache", HealthCheckerFunc(func(ctx context.Context) error { return nil }))
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	check := func(wantStatus int) HealthReport {
+		rec := httptest.NewRecorder()
+		lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != wantStatus {
+			t.Fatalf("expected %d, got %d: %s", wantStatus, rec.Code, rec.Body.String())
+		}
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid report: %v", err)
+		}
+		return report
+	}
+
+	report := check(http.StatusOK)
+	if !report.Healthy || len(report.Checks) != 2 || report.Checks[0].Name != "db" || !report.Checks[1].Healthy {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	dbDown.Store(true)
+	report = check(http.StatusServiceUnavailable)
+	if report.Healthy || report.Checks[0].Error != "connection refused" || !report.Checks[1].Healthy {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Fatalf("liveness must not run health checks, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHealthCheckIntervalAndSeverity(t *testing.T) {
+
+	var dbRuns atomic.Int64
+	var dbDown, cacheDown atomic.Bool
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	lmux.EnableHealthEndpoints("/healthz", "/readyz")
+	lmux.SetHealthDetails(true)
+	lmux.AddHealthCheckWithConfig("db", HealthCheckerFunc(func(ctx context.Context) error {
+		dbRuns.Add(1)
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}), HealthCheckConfig{Interval: 300 * time.Millisecond})
+	lmux.AddHealthCheckWithConfig("cache", HealthCheckerFunc(func(ctx context.Context) error {
+		if cacheDown.Load() {
+			return errors.New("timeout")
+		}
+		return nil
+	}), HealthCheckConfig{Severity: HealthDegraded})
+	lmux.AddHealthCheckWithConfig("slow", HealthCheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), HealthCheckConfig{Severity: HealthDegraded, Timeout: 10 * time.Millisecond})
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	check := func(wantCode int, wantStatus HealthStatus) HealthReport {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var report HealthReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("invalid report: %v", err)
+		}
+		if resp.StatusCode != wantCode || report.Status != wantStatus {
+			t.Fatalf("expected %d %s, got %d %+v", wantCode, wantStatus, resp.StatusCode, report)
+		}
+		return report
+	}
+
+	report := check(http.StatusOK, HealthDegraded)
+	if !report.Healthy || report.Checks[2].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	runs := dbRuns.Load()
+	for range 5 {
+		check(http.StatusOK, HealthDegraded)
+	}
+	if dbRuns.Load() > runs+1 {
+		t.Fatalf("interval check must not run per probe, ran %d times", dbRuns.Load()-runs)
+	}
+
+	cacheDown.Store(true)
+	dbDown.Store(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for lmux.Health(context.Background()).Healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("interval check never refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	report = check(http.StatusServiceUnavailable, HealthDown)
+	if report.Healthy || report.Checks[0].Error != "connection refused" || report.Checks[0].Severity != HealthDown {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestHealthDetailsHidden(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{})
+	lmux.EnableHealthEndpoints("/healthz", "/readyz")
+	lmux.AddHealthCheck("db", HealthCheckerFunc(func(ctx context.Context) error {
+		return errors.New("dial tcp db.internal:5432: connection refused")
+	}))
+	lmux.ApplyRoutes()
+	lmux.ApplyGlobalMiddlewares()
+
+	rec := httptest.NewRecorder()
+	lmux.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "db.internal") ||
+		!strings.Contains(rec.Body.String(), `{"name":"db","healthy":false,"severity":"down"}`) {
+		t.Fatalf("expected only check names and status, got %d %s", rec.Code, rec.Body.String())
+	}
+	if report := lmux.Health(context.Background()); report.Checks[0].Error == "" {
+		t.Fatalf("expected Health to keep the error, got %+v", report)
+	}
+}
+
+func TestHealthCheckIntervalWithoutRun(t *testing.T) {
+
+	var runs atomic.Int64
+	lmux := NewLightMux(&http.Server{})
+	lmux.AddHealthCheckWithConfig("db", HealthCheckerFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}), HealthCheckConfig{Interval: 20 * time.Millisecond, Timeout: 10 * time.Millisecond})
+
+	lmux.Health(context.Background())
+	lmux.Health(context.Background())
+	if runs.Load() != 1 {
+		t.Fatalf("expected the cached result to be served, ran %d times", runs.Load())
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if report := lmux.Health(context.Background()); runs.Load() != 2 || time.Since(report.Checks[0].CheckedAt) > 40*time.Millisecond {
+		t.Fatalf("expected the stale result to be refreshed, ran %d times: %+v", runs.Load(), report)
+	}
+}
+
+func TestStartWait(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	if err := lmux.Start(); err == nil {
+		t.Fatal("expected Start to return the bind error")
+	}
+	if err := lmux.Wait(); err == nil || lmux.Err() == nil {
+		t.Fatal("expected Wait and Err to report the bind error")
+	}
+	ln.Close()
+
+	lmux = NewLightMux(&http.Server{Addr: addr})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request failed right after Start: %v", err)
+	}
+	resp.Body.Close()
+	if lmux.Err() != nil {
+		t.Fatalf("expected no error while running, got %v", lmux.Err())
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := lmux.Wait(); err != nil {
+		t.Fatalf("expected clean stop, got %v", err)
+	}
+}
+
+func TestRunContextCancelDrains(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	entered := make(chan struct{})
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	lmux.NewRoute("/slow").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	bodyCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			bodyCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		bodyCh <- string(body)
+	}()
+	<-entered
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run must return nil after cancellation, got %v", err)
+	}
+	if body := <-bodyCh; body != "done" {
+		t.Fatalf("expected the in-flight request to complete, got %q", body)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := StdLogger(log.New(&buf, "", 0))
+
+	lmux := New(
+		WithServer(&http.Server{MaxHeaderBytes: 4096}),
+		WithAddr("127.0.0.1:0"),
+		WithReadTimeout(time.Second),
+		WithReadHeaderTimeout(2*time.Second),
+		WithWriteTimeout(3*time.Second),
+		WithIdleTimeout(4*time.Second),
+		WithLogger(logger),
+		WithShutdownTimeout(time.Minute),
+	)
+
+	srv := lmux.server
+	if srv.Addr != "127.0.0.1:0" || srv.MaxHeaderBytes != 4096 || srv.ReadTimeout != time.Second ||
+		srv.ReadHeaderTimeout != 2*time.Second || srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Fatalf("options not applied to the server: %+v", srv)
+	}
+	if srv.ErrorLog == nil || srv.ErrorLog.Writer() != &buf || lmux.shutdownTimeout != time.Minute {
+		t.Fatal("logger or shutdown timeout not applied")
+	}
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	lmux.Shutdown(context.Background())
+	if !strings.Contains(buf.String(), "Starting LightMux addr=127.0.0.1:") {
+		t.Fatalf("expected lifecycle messages in the logger, got %q", buf.String())
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	lmux := New(WithAddr("127.0.0.1:0"), WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	lmux.Shutdown(context.Background())
+
+	lmux.server.ErrorLog.Print("http: TLS handshake error")
+	out := buf.String()
+	if !strings.Contains(out, `"level":"INFO","msg":"Starting LightMux","addr":"127.0.0.1:`) {
+		t.Fatalf("expected structured lifecycle messages, got %s", out)
+	}
+	if !strings.Contains(out, `"level":"ERROR","msg":"http: TLS handshake error"`) {
+		t.Fatalf("expected server errors at error level, got %s", out)
+	}
+}
+
+func TestDefaultTimeouts(t *testing.T) {
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0", ReadTimeout: time.Minute})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	lmux.Shutdown(context.Background())
+
+	srv := lmux.server
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.IdleTimeout != DefaultIdleTimeout {
+		t.Fatalf("expected default timeouts, got %+v", srv)
+	}
+	if srv.ReadTimeout != time.Minute || srv.WriteTimeout != 0 {
+		t.Fatalf("explicit timeouts must be kept and WriteTimeout left unset, got %+v", srv)
+	}
+
+	lmux = New(WithAddr("127.0.0.1:0"), WithoutDefaultTimeouts())
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	lmux.Shutdown(context.Background())
+	if lmux.server.ReadHeaderTimeout != 0 || lmux.server.IdleTimeout != 0 {
+		t.Fatalf("expected no default timeouts, got %+v", lmux.server)
+	}
+}
+
+func TestListenerOptions(t *testing.T) {
+
+	var accepted atomic.Int32
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.SetListenerOptions(ListenerOptions{
+		KeepAlive:             time.Minute,
+		DisableHTTPKeepAlives: true,
+		WrapConn: func(c net.Conn) net.Conn {
+			accepted.Add(1)
+			return c
+		},
+	})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	addr := lmux.restart.listeners[0].ln.Addr().String()
+	for range 2 {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if !resp.Close {
+			t.Fatal("expected Connection: close with HTTP keep-alives disabled")
+		}
+	}
+	if got := accepted.Load(); got != 2 {
+		t.Fatalf("expected 2 wrapped connections, got %d", got)
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+
+	v2 := func(cmd, family byte, addrs []byte) string {
+		header := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x20|cmd, family, 0, byte(len(addrs)))
+		return string(append(header, addrs...))
+	}
+	v4addrs := []byte{198, 51, 100, 1, 10, 0, 0, 1, 0x1f, 0x90, 0, 80}
+	v6addrs := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x04, 0xd2, 0, 80)
+
+	cases := []struct {
+		header   string
+		optional bool
+		want     string
+		err      bool
+	}{
+		{header: "PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n", want: "203.0.113.7:56324"},
+		{header: "PROXY TCP6 2001:db8::7 2001:db8::1 56324 443\r\n", want: "[2001:db8::7]:56324"},
+		{header: "PROXY UNKNOWN\r\n", want: ""},
+		{header: v2(1, 0x11, v4addrs), want: "198.51.100.1:8080"},
+		{header: v2(1, 0x21, v6addrs), want: "[2001:db8::1]:1234"},
+		{header: v2(0, 0x00, nil), want: ""},
+		{header: "GET / HTTP/1.1\r\n", optional: true, want: ""},
+		{header: "GET / HTTP/1.1\r\n", err: true},
+		{header: "PROXY TCP4 not-an-ip 10.0.0.1 1 2\r\n", err: true},
+	}
+	for _, tc := range cases {
+		addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(tc.header+"rest")), tc.optional)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("expected error for %q", tc.header)
+			}
+			continue
+		}
+		got := ""
+		if addr != nil {
+			got = addr.String()
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("header %q: expected %q, got %q (%v)", tc.header, tc.want, got, err)
+		}
+	}
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.EnableProxyProtocol(ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1/32"}})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", lmux.restart.listeners[0].ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 80\r\nGET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "203.0.113.7:56324" {
+		t.Fatalf("expected the client address from the PROXY header, got %q", body)
+	}
+}
+
+func TestLimitConnections(t *testing.T) {
+
+	var rejects atomic.Int32
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.LimitConnections(ConnLimitConfig{Max: 1, OnReject: func(net.Addr) { rejects.Add(1) }})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+	addr := lmux.restart.listeners[0].ln.Addr().String()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF && !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("expected the connection over the limit to be closed, got %v", err)
+	}
+	second.Close()
+
+	stats := lmux.ConnLimitStats()
+	if stats.Active != 1 || stats.Rejected != 1 || rejects.Load() != 1 {
+		t.Fatalf("unexpected stats: %+v, rejects %d", stats, rejects.Load())
+	}
+
+	first.Close()
+	time.Sleep(20 * time.Millisecond)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request after a slot was freed failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestConnStats(t *testing.T) {
+
+	var userStates, hookStates atomic.Int32
+
+	lmux := NewLightMux(&http.Server{
+		Addr:      "127.0.0.1:0",
+		ConnState: func(net.Conn, http.ConnState) { userStates.Add(1) },
+	})
+	lmux.OnConnState(func(c net.Conn, state http.ConnState) { hookStates.Add(1) })
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer lmux.Shutdown(context.Background())
+	addr := lmux.restart.listeners[0].ln.Addr().String()
+
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	stats := lmux.ConnStats()
+	if stats.Accepted != 1 || stats.Idle != 1 || stats.Active != 0 || stats.New != 0 {
+		t.Fatalf("expected one idle keep-alive connection, got %+v", stats)
+	}
+
+	transport.CloseIdleConnections()
+	time.Sleep(20 * time.Millisecond)
+
+	stats = lmux.ConnStats()
+	if stats.Closed != 1 || stats.Idle != 0 {
+		t.Fatalf("expected the connection to be closed, got %+v", stats)
+	}
+	if userStates.Load() == 0 || userStates.Load() != hookStates.Load() {
+		t.Fatalf("expected the server ConnState and hooks to be called, got %d and %d", userStates.Load(), hookStates.Load())
+	}
+}
+
+type testCloser struct {
+	name   string
+	closed *[]string
+}
+
+func (c testCloser) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return nil
+}
+
+func TestOnDrainComplete(t *testing.T) {
+
+	var closed []string
+
+	lmux := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	lmux.onStop(func(ctx context.Context) error {
+		closed = append(closed, "internal")
+		return nil
+	})
+	lmux.RegisterCloser(testCloser{name: "consumer", closed: &closed})
+	lmux.RegisterCloser(testCloser{name: "db", closed: &closed})
+	lmux.OnDrainComplete(func(ctx context.Context) error {
+		closed = append(closed, "cache")
+		return errors.New("flush failed")
+	})
+
+	if err := lmux.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	err := lmux.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "flush failed") {
+		t.Fatalf("expected the hook error, got %v", err)
+	}
+	if got := strings.Join(closed, ","); got != "internal,consumer,db,cache" {
+		t.Fatalf("unexpected close order: %s", got)
+	}
+}
+
+func TestConfigLoading(t *testing.T) {
+
+	t.Setenv("LIGHTMUX_ADDR", "127.0.0.1:9000")
+	t.Setenv("LIGHTMUX_READ_TIMEOUT", "15s")
+	t.Setenv("LIGHTMUX_SHUTDOWN_TIMEOUT", "1m")
+	t.Setenv("LIGHTMUX_LOG_LEVEL", "warn")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("loading env config failed: %v", err)
+	}
+	lmux := New(cfg.Options()...)
+	if lmux.server.Addr != "127.0.0.1:9000" || lmux.server.ReadTimeout != 15*time.Second || lmux.shutdownTimeout != time.Minute {
+		t.Fatalf("config not applied: %+v", cfg)
+	}
+	if logger, ok := lmux.logger.(*slog.Logger); !ok || logger.Enabled(context.Background(), slog.LevelInfo) || cfg.TLS() {
+		t.Fatal("expected lifecycle logs at warn level and no TLS")
+	}
+
+	t.Setenv("LIGHTMUX_IDLE_TIMEOUT", "soon")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected error for an invalid duration")
+	}
+
+	path := filepath.Join(t.TempDir(), "lightmux.json")
+	os.WriteFile(path, []byte(`{"addr": ":8443", "write_timeout": "30s", "tls_cert_file": "cert.pem", "tls_key_file": "key.pem", "log_level": "debug"}`), 0o600)
+	cfg, err = ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("loading file config failed: %v", err)
+	}
+	if cfg.Addr != ":8443" || cfg.WriteTimeout != 30*time.Second || !cfg.TLS() || cfg.LogLevel != slog.LevelDebug {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	os.WriteFile(path, []byte(`{"adr": ":8443"}`), 0o600)
+	if _, err := ConfigFromFile(path); err == nil {
+		t.Fatal("expected error for an unknown key")
+	}
+}
+
+func TestRunTLSCertReload(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	lmux := NewLightMux(&http.Server{Addr: addr})
+	lmux.NewRoute("/").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	lmux.SetCertWatchInterval(20 * time.Millisecond)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- lmux.RunTLS(context.Background(), certFile, keyFile) }()
+	time.Sleep(50 * time.Millisecond)
+
+	peerCert := func() []byte {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Raw
+	}
+
+	first := peerCert()
+	writeTestCert(t, dir)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	time.Sleep(100 * time.Millisecond)
+
+	second := peerCert()
+	if bytes.Equal(first, second) {
+		t.Fatal("expected the changed certificate files to be reloaded")
+	}
+
+	writeTestCert(t, dir)
+	if err := lmux.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if bytes.Equal(second, peerCert()) {
+		t.Fatal("expected Reload to reload the certificate files")
+	}
+
+	if err := lmux.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("RunTLS failed: %v", err)
+	}
+}
+
+func TestCertReloadFailureReportedOnce(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+	cert, err := LoadCertificateFiles(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("loading certificate failed: %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	if !cert.filesChanged() {
+		t.Fatal("expected the broken change to be detected")
+	}
+	if err := cert.ReloadFiles(); err == nil {
+		t.Fatal("expected the invalid certificate to fail")
+	}
+	if cert.filesChanged() {
+		t.Fatal("expected the failed reload to be recorded, so the watcher reports it once")
+	}
+	if current, _ := cert.GetCertificate(nil); current == nil {
+		t.Fatal("expected the previous certificate to be kept")
+	}
+}
+
+func TestRunServers(t *testing.T) {
+
+	var logs bytes.Buffer
+	api := New(WithAddr("127.0.0.1:0"), WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	admin := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- RunServers(ctx, api, admin) }()
+	time.Sleep(50 * time.Millisecond)
+
+	if api.Draining() || admin.Draining() {
+		t.Fatal("servers must be running")
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("RunServers failed: %v", err)
+	}
+	if !api.Draining() || !admin.Draining() {
+		t.Fatal("expected both servers to be shut down")
+	}
+	if !strings.Contains(logs.String(), `"msg":"All components stopped."`) {
+		t.Fatalf("expected runner messages in the logger of the first server, got %q", logs.String())
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	healthy := NewLightMux(&http.Server{Addr: "127.0.0.1:0"})
+	broken := NewLightMux(&http.Server{Addr: ln.Addr().String()})
+	if err := RunServers(context.Background(), healthy, broken); err == nil {
+		t.Fatal("expected the bind error of one server")
+	}
+	if !healthy.Draining() {
+		t.Fatal("expected the healthy server to be stopped when another fails")
+	}
+}
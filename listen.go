@@ -0,0 +1,176 @@
+package lightmux
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// IPFamily selects the IP protocol family the server listens on.
+type IPFamily int
+
+const (
+	// DualStack listens on IPv4 and IPv6 where available (default).
+	DualStack IPFamily = iota
+	// IPv4Only listens on IPv4 only.
+	IPv4Only
+	// IPv6Only listens on IPv6 only, IPv4-mapped connections are not accepted.
+	IPv6Only
+)
+
+func (f IPFamily) String() string {
+	switch f {
+	case IPv4Only:
+		return "IPv4-only"
+	case IPv6Only:
+		return "IPv6-only"
+	default:
+		return "dual-stack"
+	}
+}
+
+// network returns the net.Listen network name for the family.
+func (f IPFamily) network() string {
+	switch f {
+	case IPv4Only:
+		return "tcp4"
+	case IPv6Only:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// SetIPFamily selects whether Run and RunTLS listen on IPv4, IPv6 or both (default).
+func (l *LightMux) SetIPFamily(family IPFamily) {
+	l.ipFamily = family
+}
+
+// ListenAddr formats host and port into a listen address, adding brackets to IPv6 hosts
+// (e.g. ListenAddr("::1", 8080) == "[::1]:8080"). An empty host listens on all interfaces.
+func ListenAddr(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// listen validates addr against the configured IP family and opens the listener.
+// defaultAddr is used when addr is empty, like http.Server does.
+func (l *LightMux) listen(addr, defaultAddr string) (net.Listener, error) {
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: invalid listen address %q: %w", addr, err)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		switch {
+		case l.ipFamily == IPv4Only && !ip.Unmap().Is4():
+			return nil, fmt.Errorf("lightmux: listen address %q is IPv6, but %s listening was requested", addr, l.ipFamily)
+		case l.ipFamily == IPv6Only && (ip.Is4() || ip.Is4In6()):
+			return nil, fmt.Errorf("lightmux: listen address %q is IPv4, but %s listening was requested", addr, l.ipFamily)
+		}
+	}
+
+	if ln, err := inheritedListener(addr); ln != nil || err != nil {
+		if ln != nil {
+			l.restart.track(addr, ln)
+			return l.tuneListener(ln), nil
+		}
+		return nil, err
+	}
+
+	ln, err := net.Listen(l.ipFamily.network(), addr)
+	if err != nil {
+		if l.ipFamily != IPv4Only && (errors.Is(err, syscall.EAFNOSUPPORT) || errors.Is(err, syscall.EADDRNOTAVAIL)) {
+			return nil, fmt.Errorf("lightmux: %s listen on %q failed, IPv6 may be unavailable on this host: %w", l.ipFamily, addr, err)
+		}
+		return nil, fmt.Errorf("lightmux: %s listen on %q: %w", l.ipFamily, addr, err)
+	}
+	l.restart.track(addr, ln)
+	return l.tuneListener(ln), nil
+}
+
+// ListenerOptions tunes the connections accepted by all listeners, see SetListenerOptions.
+// The listen backlog is not configurable in Go, it follows the OS limit (net.core.somaxconn on Linux).
+type ListenerOptions struct {
+	// KeepAlive sets the TCP keep-alive period of accepted connections, zero keeps the Go default (15 seconds),
+	// negative disables TCP keep-alives.
+	KeepAlive time.Duration
+	// DisableHTTPKeepAlives closes connections after each response instead of reusing them.
+	DisableHTTPKeepAlives bool
+	// DisableNoDelay enables Nagle's algorithm, which Go disables by default (TCP_NODELAY).
+	DisableNoDelay bool
+	// WrapConn wraps each accepted connection, e.g. for byte counting or custom deadlines.
+	WrapConn func(c net.Conn) net.Conn
+}
+
+// SetListenerOptions tunes the connections accepted by Run, RunTLS, Start and additional listeners.
+func (l *LightMux) SetListenerOptions(opts ListenerOptions) {
+	l.listenerOpts = opts
+}
+
+// WithListenerOptions tunes accepted connections, see SetListenerOptions.
+func WithListenerOptions(opts ListenerOptions) Option {
+	return func(l *LightMux) {
+		l.SetListenerOptions(opts)
+	}
+}
+
+// tuneListener applies the ListenerOptions to ln.
+func (l *LightMux) tuneListener(ln net.Listener) net.Listener {
+	opts := l.listenerOpts
+	if opts.DisableHTTPKeepAlives {
+		l.server.SetKeepAlivesEnabled(false)
+	}
+	if opts.KeepAlive == 0 && !opts.DisableNoDelay && opts.WrapConn == nil && l.proxyProto == nil && l.connLimit == nil {
+		return ln
+	}
+	return &tunedListener{Listener: ln, opts: opts, proxyProto: l.proxyProto, connLimit: l.connLimit}
+}
+
+type tunedListener struct {
+	net.Listener
+	opts       ListenerOptions
+	proxyProto *proxyProtocol
+	connLimit  *connLimiter
+}
+
+func (ln *tunedListener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if tc, ok := c.(*net.TCPConn); ok {
+			switch {
+			case ln.opts.KeepAlive < 0:
+				tc.SetKeepAlive(false)
+			case ln.opts.KeepAlive > 0:
+				tc.SetKeepAlive(true)
+				tc.SetKeepAlivePeriod(ln.opts.KeepAlive)
+			}
+			if ln.opts.DisableNoDelay {
+				tc.SetNoDelay(false)
+			}
+		}
+		if ln.connLimit != nil {
+			var ok bool
+			if c, ok = ln.connLimit.acquire(c); !ok {
+				continue
+			}
+		}
+		if ln.proxyProto != nil {
+			c = ln.proxyProto.wrap(c)
+		}
+		if ln.opts.WrapConn != nil {
+			c = ln.opts.WrapConn(c)
+		}
+		return c, nil
+	}
+}
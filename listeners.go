@@ -0,0 +1,126 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ListenerConfig describes an additional listener serving the route table of a LightMux, see AddListener.
+type ListenerConfig struct {
+	// Addr to listen on, e.g. ":8443" or "127.0.0.1:9090".
+	Addr string
+	// Middlewares wrap the requests of this listener only, outside of the global middlewares,
+	// e.g. an admin guard on a localhost port.
+	Middlewares []Middleware
+	// CertFile and KeyFile serve the listener over TLS when set.
+	CertFile string
+	KeyFile  string
+}
+
+// extraListener is a listener registered with AddListener and the server serving it.
+// A nil handler serves the route table, otherwise it replaces it (e.g. the HTTPS redirect listener).
+type extraListener struct {
+	cfg     ListenerConfig
+	handler http.Handler
+	server  *http.Server
+}
+
+// AddListener makes Run and RunTLS also serve the routes on cfg.Addr, with the timeouts and TLS config
+// of the main server. All listeners start together and shut down together; if one of them fails, all are stopped.
+// It panics if the address is empty or already registered.
+func (l *LightMux) AddListener(cfg ListenerConfig) {
+	if cfg.Addr == "" {
+		panic("listener address must not be empty")
+	}
+	for _, extra := range l.listeners {
+		if extra.cfg.Addr == cfg.Addr {
+			panic("duplicate listener address: " + cfg.Addr)
+		}
+	}
+	l.listeners = append(l.listeners, &extraListener{cfg: cfg, server: &http.Server{}})
+}
+
+// listenExtra opens the listeners registered with AddListener and prepares their servers,
+// closing the already opened ones if one fails.
+func (l *LightMux) listenExtra() ([]net.Listener, error) {
+	lns := make([]net.Listener, 0, len(l.listeners))
+	for _, extra := range l.listeners {
+		ln, err := l.listen(extra.cfg.Addr, "")
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+
+		srv := extra.server
+		handler := extra.handler
+		if handler == nil {
+			handler = l.server.Handler
+		}
+		srv.Handler = chainMiddlewares(handler.ServeHTTP, extra.cfg.Middlewares)
+		srv.ReadTimeout = l.server.ReadTimeout
+		srv.ReadHeaderTimeout = l.server.ReadHeaderTimeout
+		srv.WriteTimeout = l.server.WriteTimeout
+		srv.IdleTimeout = l.server.IdleTimeout
+		srv.MaxHeaderBytes = l.server.MaxHeaderBytes
+		srv.ErrorLog = l.server.ErrorLog
+		srv.ConnState = l.server.ConnState
+		srv.SetKeepAlivesEnabled(!l.listenerOpts.DisableHTTPKeepAlives)
+		if l.server.TLSConfig != nil {
+			srv.TLSConfig = l.server.TLSConfig.Clone()
+		}
+	}
+	return lns, nil
+}
+
+// serve serves the listener opened by listenExtra.
+func (extra *extraListener) serve(ln net.Listener) error {
+	if extra.cfg.CertFile != "" || extra.cfg.KeyFile != "" {
+		return extra.server.ServeTLS(ln, extra.cfg.CertFile, extra.cfg.KeyFile)
+	}
+	return extra.server.Serve(ln)
+}
+
+// shutdownServers gracefully shuts down the main server, the additional listeners and the HTTP/3 server concurrently.
+func (l *LightMux) shutdownServers(ctx context.Context) error {
+	return l.eachServer(ctx, func(srv *http.Server) error { return srv.Shutdown(ctx) })
+}
+
+// closeServers immediately closes the main server, the additional listeners and the HTTP/3 server,
+// ctx is expected to be cancelled already.
+func (l *LightMux) closeServers(ctx context.Context) error {
+	return l.eachServer(ctx, (*http.Server).Close)
+}
+
+func (l *LightMux) eachServer(ctx context.Context, fn func(srv *http.Server) error) error {
+	errs := make([]error, len(l.listeners)+2)
+	var wg sync.WaitGroup
+	for i := range len(l.listeners) + 1 {
+		srv := l.server
+		if i > 0 {
+			srv = l.listeners[i-1].server
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(srv)
+		}()
+	}
+	if l.http3 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Close passes a cancelled context, which is not an error here
+			if err := l.http3.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+				errs[len(errs)-1] = err
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
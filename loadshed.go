@@ -0,0 +1,102 @@
+package lightmux
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is passed to Error when the LoadShedder rejects a request.
+var ErrOverloaded = errors.New("server overloaded")
+
+// LoadShedConfig configures the LoadShedder middleware. Without any limit set, nothing is shed.
+type LoadShedConfig struct {
+	// MaxInFlight limits requests processed concurrently, zero means unlimited.
+	MaxInFlight int
+	// MaxQueue limits requests waiting for an in-flight slot, further ones are rejected immediately.
+	MaxQueue int
+	// MaxWait is how long a queued request waits for a slot before being rejected. Default: 100ms.
+	MaxWait time.Duration
+	// Overloaded is an optional custom check (e.g. CPU or dependency health), true rejects the request.
+	Overloaded func(r *http.Request) bool
+	// RetryAfter is sent in the Retry-After header of rejected requests, default: 1 second.
+	RetryAfter time.Duration
+	// OnShed overrides the default response, which calls lightmux.Error with 503 and ErrOverloaded.
+	// Retry-After is already set.
+	OnShed http.HandlerFunc
+}
+
+// LoadShedder returns a middleware rejecting excess traffic early with 503 and Retry-After,
+// so an overloaded server degrades gracefully instead of piling up goroutines.
+// Each returned middleware has its own limits, so it can be applied globally or per group.
+func LoadShedder(cfg LoadShedConfig) Middleware {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 100 * time.Millisecond
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	retryAfter := strconv.Itoa(int((cfg.RetryAfter + time.Second - 1) / time.Second))
+
+	var slots chan struct{}
+	if cfg.MaxInFlight > 0 {
+		slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	var queued atomic.Int64
+
+	shed := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", retryAfter)
+		if cfg.OnShed != nil {
+			cfg.OnShed(w, r)
+			return
+		}
+		Error(w, r, http.StatusServiceUnavailable, ErrOverloaded)
+	}
+
+	// acquire takes an in-flight slot, waiting in the queue for at most MaxWait.
+	acquire := func(r *http.Request) bool {
+		select {
+		case slots <- struct{}{}:
+			return true
+		default:
+		}
+
+		if queued.Add(1) > int64(cfg.MaxQueue) {
+			queued.Add(-1)
+			return false
+		}
+		defer queued.Add(-1)
+
+		timer := time.NewTimer(cfg.MaxWait)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+			return true
+		case <-timer.C:
+			return false
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Overloaded != nil && cfg.Overloaded(r) {
+				shed(w, r)
+				return
+			}
+
+			if slots != nil {
+				if !acquire(r) {
+					shed(w, r)
+					return
+				}
+				defer func() { <-slots }()
+			}
+
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package lightmux
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Logger receives the messages of LightMux (startup, shutdown, reloads and their errors), see WithLogger.
+// Arguments are alternating keys and values like slog, so a *slog.Logger can be used directly;
+// zap, zerolog and other loggers only need a small adapter.
+type Logger interface {
+	Info(msg string, args ...any)
+	Error(msg string, args ...any)
+	Debug(msg string, args ...any)
+}
+
+// StdLogger adapts a standard library logger, printing messages as "msg key=value ...".
+// Debug messages are dropped. It is the default Logger, writing to log.Default().
+func StdLogger(logger *log.Logger) Logger {
+	return stdLogger{logger}
+}
+
+type stdLogger struct {
+	*log.Logger
+}
+
+func (s stdLogger) Info(msg string, args ...any) {
+	s.Print(formatLogMessage(msg, args))
+}
+
+func (s stdLogger) Error(msg string, args ...any) {
+	s.Print(formatLogMessage("lightmux: "+msg, args))
+}
+
+func (s stdLogger) Debug(string, ...any) {}
+
+func formatLogMessage(msg string, args []any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	return b.String()
+}
+
+// errorLog returns a standard logger forwarding to logger.Error, used as http.Server.ErrorLog.
+func errorLog(logger Logger) *log.Logger {
+	if s, ok := logger.(stdLogger); ok {
+		return s.Logger
+	}
+	return log.New(errorLogWriter{logger}, "", 0)
+}
+
+type errorLogWriter struct {
+	logger Logger
+}
+
+func (w errorLogWriter) Write(p []byte) (int, error) {
+	w.logger.Error(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// requestLogger returns the Logger of the LightMux serving r (see WithLogger), or the standard logger
+// for requests served elsewhere.
+func requestLogger(r *http.Request) Logger {
+	return loggerOr(nil, r)
+}
+
+// loggerOr returns logger, or the default of requestLogger if it is nil.
+func loggerOr(logger Logger, r *http.Request) Logger {
+	if logger != nil {
+		return logger
+	}
+	if info := requestInfoFrom(r.Context()); info != nil && info.mux != nil {
+		return info.mux.logger
+	}
+	return StdLogger(log.Default())
+}
@@ -0,0 +1,184 @@
+package lightmux
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RequestLoggerConfig configures the RequestLogger middleware.
+type RequestLoggerConfig struct {
+	// Logger receives the records, default: slog.Default().
+	Logger *slog.Logger
+	// Message of every record, default: "request".
+	Message string
+	// Attrs is an optional hook returning extra attributes appended to the record.
+	Attrs func(r *http.Request, status int) []slog.Attr
+	// SampleRate is the fraction of successful (status < 400) requests logged, e.g. 0.01 for 1%,
+	// so high-volume routes don't flood the log pipeline. 4xx and 5xx responses are always logged.
+	// Rates outside (0, 1), including the unset 0, log every request.
+	SampleRate float64
+	// RouteSampleRates overrides SampleRate by route pattern, e.g. {"/healthz": 0.001}.
+	// A route rate of 0 (or less) never logs successful requests of the route.
+	RouteSampleRates map[string]float64
+}
+
+// RequestLogger returns a middleware writing one structured record per request through log/slog
+// with method, path, matched route pattern, status, bytes, latency, client IP (see RealIP) and request ID (if assigned).
+// Records are logged at Info level, Warn for 4xx and Error for 5xx responses.
+// It is meant to be registered globally with LightMux.Use.
+func RequestLogger(cfg RequestLoggerConfig) Middleware {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Message == "" {
+		cfg.Message = "request"
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, _ = withRequestInfo(r)
+			rec := newResponseRecorder(w)
+
+			next(rec, r)
+
+			status := rec.Status()
+			if status < 400 && !cfg.sampled(RoutePattern(r)) {
+				return
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", RoutePattern(r)),
+				slog.Int("status", status),
+				slog.Int("bytes", rec.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("remote_ip", ClientIP(r)),
+			}
+			if id := RequestID(r); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			if id := TraceID(r); id != "" {
+				attrs = append(attrs, slog.String("trace_id", id))
+			}
+			attrs = append(attrs, LogAttrs(r)...)
+			if cfg.Attrs != nil {
+				attrs = append(attrs, cfg.Attrs(r, status)...)
+			}
+
+			cfg.Logger.LogAttrs(r.Context(), statusLevel(status), cfg.Message, attrs...)
+		}
+	}
+}
+
+// sampled reports whether a successful request of route is logged.
+func (cfg RequestLoggerConfig) sampled(route string) bool {
+	rate := cfg.SampleRate
+	if rate <= 0 {
+		rate = 1
+	}
+	if routeRate, ok := cfg.RouteSampleRates[route]; ok {
+		rate = routeRate
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+type scopedLoggerCtxKey struct{}
+
+// ScopedLogger returns a middleware injecting a request-scoped logger derived from logger
+// (slog.Default() if nil) into the request context, see LoggerFrom.
+func ScopedLogger(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r, _ = withRequestInfo(r)
+			scoped := logger.With(slog.String("method", r.Method), slog.String("path", r.URL.Path))
+			next(w, r.WithContext(context.WithValue(r.Context(), scopedLoggerCtxKey{}, scoped)))
+		}
+	}
+}
+
+// LoggerFrom returns the request-scoped logger injected by ScopedLogger (slog.Default() without it),
+// with the request ID, trace ID, the matched route pattern once they are known and the attributes added with WithLogAttrs.
+func LoggerFrom(r *http.Request) *slog.Logger {
+	logger, ok := r.Context().Value(scopedLoggerCtxKey{}).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	var attrs []any
+	if id := RequestID(r); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if id := TraceID(r); id != "" {
+		attrs = append(attrs, slog.String("trace_id", id))
+	}
+	if route := RoutePattern(r); route != "" {
+		attrs = append(attrs, slog.String("route", route))
+	}
+	for _, attr := range LogAttrs(r) {
+		attrs = append(attrs, attr)
+	}
+	if len(attrs) == 0 {
+		return logger
+	}
+	return logger.With(attrs...)
+}
+
+// statusLevel maps a response status to a log level.
+func statusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// remoteIP returns the host part of r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithLogAttrs attaches attributes (e.g. user ID, tenant) to the request, so middlewares and handlers
+// can enrich its final RequestLogger record, JSON AccessLog line and LoggerFrom logger. Later attributes
+// with the same key replace earlier ones. It is a no-op for requests not served by LightMux.
+func WithLogAttrs(r *http.Request, attrs ...slog.Attr) {
+	info := requestInfoFrom(r.Context())
+	if info == nil {
+		return
+	}
+	info.logMu.Lock()
+	defer info.logMu.Unlock()
+	for _, attr := range attrs {
+		if i := slices.IndexFunc(info.logAttrs, func(a slog.Attr) bool { return a.Key == attr.Key }); i >= 0 {
+			info.logAttrs[i] = attr
+			continue
+		}
+		info.logAttrs = append(info.logAttrs, attr)
+	}
+}
+
+// LogAttrs returns the attributes attached to the request with WithLogAttrs.
+func LogAttrs(r *http.Request) []slog.Attr {
+	info := requestInfoFrom(r.Context())
+	if info == nil {
+		return nil
+	}
+	info.logMu.Lock()
+	defer info.logMu.Unlock()
+	return slices.Clone(info.logAttrs)
+}
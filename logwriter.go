@@ -0,0 +1,197 @@
+package lightmux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFileConfig configures a RotatingFile.
+type RotatingFileConfig struct {
+	// Path of the active file, e.g. "/var/log/app/access.log". Rotated files get a timestamp suffix.
+	Path string
+	// MaxSize rotates the file before it grows beyond MaxSize bytes, zero disables size-based rotation.
+	MaxSize int64
+	// Interval rotates the file once it is older than Interval (e.g. 24h), zero disables time-based rotation.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept, older ones are deleted. Zero keeps all.
+	MaxBackups int
+}
+
+// RotatingFile is an io.WriteCloser appending to a file that is rotated by size and/or age,
+// e.g. as AccessLogConfig.Output of small deployments without an external log shipper. It is safe for concurrent use.
+type RotatingFile struct {
+	cfg RotatingFileConfig
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// NewRotatingFile opens (or creates) the file at cfg.Path for appending.
+func NewRotatingFile(cfg RotatingFileConfig) (*RotatingFile, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("lightmux: rotating file path must not be empty")
+	}
+	f := &RotatingFile{cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("lightmux: open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("lightmux: open log file: %w", err)
+	}
+	f.file, f.size, f.created = file, info.Size(), info.ModTime()
+	if f.size == 0 {
+		f.created = time.Now()
+	}
+	return nil
+}
+
+// Write appends p, rotating the file first if p would exceed MaxSize or the file is older than Interval.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && ((f.cfg.MaxSize > 0 && f.size+int64(len(p)) > f.cfg.MaxSize) ||
+		(f.cfg.Interval > 0 && time.Since(f.created) >= f.cfg.Interval)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the active file, renames it with a timestamp suffix and opens a new one.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("lightmux: rotate log file: %w", err)
+	}
+	f.file = nil
+	backup := f.cfg.Path + "." + time.Now().Format("20060102T150405.000000000")
+	if err := os.Rename(f.cfg.Path, backup); err != nil {
+		// Keep appending to the active file, so a failed rotation doesn't stop logging.
+		return errors.Join(fmt.Errorf("lightmux: rotate log file: %w", err), f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune deletes the oldest rotated files beyond MaxBackups.
+func (f *RotatingFile) prune() error {
+	if f.cfg.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.cfg.Path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	var errs []error
+	for _, backup := range backups[:max(len(backups)-f.cfg.MaxBackups, 0)] {
+		errs = append(errs, os.Remove(backup))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the active file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// AsyncWriter buffers writes in memory and writes them to the underlying writer on a background goroutine,
+// so slow disks don't add latency to requests. Writes block only when the buffer is full.
+// Close flushes the buffer; register it with LightMux.RegisterCloser to flush on shutdown.
+type AsyncWriter struct {
+	w     io.Writer
+	ch    chan []byte
+	done  chan struct{}
+	once  sync.Once
+	mu    sync.RWMutex
+	close bool
+	err   error
+}
+
+// NewAsyncWriter creates an AsyncWriter buffering up to size writes (default 1024) in front of w.
+func NewAsyncWriter(w io.Writer, size int) *AsyncWriter {
+	if size <= 0 {
+		size = 1024
+	}
+	a := &AsyncWriter{w: w, ch: make(chan []byte, size), done: make(chan struct{})}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for p := range a.ch {
+		if _, err := a.w.Write(p); err != nil && a.err == nil {
+			a.err = err
+		}
+	}
+}
+
+// Write queues a copy of p. Errors of the underlying writer are returned by Close.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.close {
+		return 0, os.ErrClosed
+	}
+	a.ch <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// Close flushes the buffered writes, closes the underlying writer if it is an io.Closer
+// and returns the first write error.
+func (a *AsyncWriter) Close() error {
+	a.once.Do(func() {
+		a.mu.Lock()
+		a.close = true
+		close(a.ch)
+		a.mu.Unlock()
+		<-a.done
+		if c, ok := a.w.(io.Closer); ok {
+			a.err = errors.Join(a.err, c.Close())
+		}
+	})
+	return a.err
+}
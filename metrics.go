@@ -0,0 +1,343 @@
+package lightmux
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMetricsDurationBuckets are the upper bounds, in seconds, of the request duration histogram.
+var DefaultMetricsDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultMetricsSizeBuckets are the upper bounds, in bytes, of the request and response size histograms.
+var DefaultMetricsSizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+// EnableMetrics serves Prometheus metrics on path (e.g. "/metrics"): request count, duration, request and response size
+// histograms labeled by route pattern, method and status class, and the number of requests in flight.
+// Labels never contain raw paths, so cardinality stays bounded; requests matching no route are not counted.
+// The endpoint is protected by the admin guard if set, middlewares run after it. It must be called before Run.
+// Duration buckets can be changed with EnableLatencyHistograms.
+func (l *LightMux) EnableMetrics(path string, middlewares ...Middleware) {
+	l.metricsRegistry()
+	l.adminRoute(path, middlewares...).Handle(http.MethodGet, l.serveMetrics)
+}
+
+// EnableLatencyHistograms collects request latency histograms by route pattern and method with the given
+// bucket upper bounds (DefaultMetricsDurationBuckets if none), readable with LatencyHistograms for custom exporters
+// and served by the metrics endpoint (see EnableMetrics). It must be called before Run.
+func (l *LightMux) EnableLatencyHistograms(buckets ...time.Duration) {
+	m := l.metricsRegistry()
+	if len(buckets) == 0 {
+		return
+	}
+	m.durationBuckets = make([]float64, len(buckets))
+	for i, b := range buckets {
+		m.durationBuckets[i] = b.Seconds()
+	}
+	sort.Float64s(m.durationBuckets)
+}
+
+// LatencyHistogram is the latency distribution of a route method across status classes, see LatencyHistograms.
+type LatencyHistogram struct {
+	Route  string
+	Method string
+	// Buckets are the upper bounds, Counts the requests per bucket (not cumulative);
+	// the last count is for requests slower than all bounds.
+	Buckets []time.Duration
+	Counts  []int64
+	Count   int64
+	Sum     time.Duration
+}
+
+// Quantile estimates the q-quantile (e.g. 0.99) by linear interpolation within its bucket, like Prometheus'
+// histogram_quantile. It returns the largest bound if the quantile falls above it, 0 without requests.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	var cumulative int64
+	for i, bound := range h.Buckets {
+		prev := cumulative
+		cumulative += h.Counts[i]
+		if float64(cumulative) >= rank {
+			lower := time.Duration(0)
+			if i > 0 {
+				lower = h.Buckets[i-1]
+			}
+			if h.Counts[i] == 0 {
+				return bound
+			}
+			return lower + time.Duration(float64(bound-lower)*(rank-float64(prev))/float64(h.Counts[i]))
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// LatencyHistograms returns the latency histograms by route pattern and method, sorted by route and method.
+// Route methods without requests are left out. It returns nil unless EnableLatencyHistograms or EnableMetrics was called.
+func (l *LightMux) LatencyHistograms() []LatencyHistogram {
+	if l.metrics == nil {
+		return nil
+	}
+	m := l.metrics
+	bounds := make([]time.Duration, len(m.durationBuckets))
+	for i, b := range m.durationBuckets {
+		bounds[i] = time.Duration(b * float64(time.Second))
+	}
+
+	routes := m.sortedRoutes()
+	histograms := make([]LatencyHistogram, 0, len(routes))
+	for _, rm := range routes {
+		h := LatencyHistogram{Route: rm.route, Method: rm.method, Buckets: bounds, Counts: make([]int64, len(bounds)+1)}
+		var sum float64
+		for class := 1; class <= 5; class++ {
+			s := rm.classes[class].Load()
+			if s == nil {
+				continue
+			}
+			for i := range s.duration.buckets {
+				n := s.duration.buckets[i].Load()
+				h.Counts[i] += n
+				h.Count += n
+			}
+			sum += math.Float64frombits(s.duration.sum.Load())
+		}
+		h.Sum = time.Duration(sum * float64(time.Second))
+		histograms = append(histograms, h)
+	}
+	return histograms
+}
+
+// TrafficStats are the request and response body sizes of a route method, see LightMux.TrafficStats.
+type TrafficStats struct {
+	Route         string
+	Method        string
+	Requests      int64
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// TotalBytes returns the bytes received and sent.
+func (s TrafficStats) TotalBytes() int64 {
+	return s.RequestBytes + s.ResponseBytes
+}
+
+// TrafficStats returns the body bytes received and sent by route pattern and method, heaviest first,
+// to find bandwidth-heavy endpoints. Size histograms are served by the metrics endpoint.
+// It returns nil unless EnableMetrics or EnableLatencyHistograms was called.
+func (l *LightMux) TrafficStats() []TrafficStats {
+	if l.metrics == nil {
+		return nil
+	}
+	routes := l.metrics.sortedRoutes()
+	stats := make([]TrafficStats, 0, len(routes))
+	for _, rm := range routes {
+		s := TrafficStats{Route: rm.route, Method: rm.method}
+		for class := 1; class <= 5; class++ {
+			if series := rm.classes[class].Load(); series != nil {
+				s.Requests += series.count.Load()
+				s.RequestBytes += int64(math.Float64frombits(series.requestSize.sum.Load()))
+				s.ResponseBytes += int64(math.Float64frombits(series.size.sum.Load()))
+			}
+		}
+		stats = append(stats, s)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].TotalBytes() > stats[j].TotalBytes() })
+	return stats
+}
+
+// metricsRegistry returns the Prometheus collectors, creating them and adding them to the metrics sinks on first use.
+func (l *LightMux) metricsRegistry() *metricsRegistry {
+	if l.metrics == nil {
+		l.metrics = &metricsRegistry{
+			durationBuckets: DefaultMetricsDurationBuckets,
+			sizeBuckets:     DefaultMetricsSizeBuckets,
+			byKey:           make(map[routeMethod]*routeMetrics),
+		}
+		l.AddMetricsSink(l.metrics)
+	}
+	return l.metrics
+}
+
+// metricsRegistry is the built-in Prometheus MetricsSink, holding the collectors of all routes.
+type metricsRegistry struct {
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu     sync.RWMutex
+	routes []*routeMetrics
+	byKey  map[routeMethod]*routeMetrics
+}
+
+type routeMethod struct {
+	route, method string
+}
+
+// routeMetrics holds the series of a route method by status class (index 1 to 5), created on first use.
+type routeMetrics struct {
+	route   string
+	method  string
+	classes [6]atomic.Pointer[metricSeries]
+}
+
+type metricSeries struct {
+	count       atomic.Int64
+	duration    histogram
+	size        histogram
+	requestSize histogram
+}
+
+// histogram counts observations per bucket; the last bucket is +Inf.
+type histogram struct {
+	buckets []atomic.Int64
+	sum     atomic.Uint64 // float64 bits
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	i := sort.SearchFloat64s(bounds, v)
+	h.buckets[i].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ObserveRequest implements MetricsSink.
+func (m *metricsRegistry) ObserveRequest(rm RequestMetric) {
+	class := rm.Status / 100
+	if class < 1 || class > 5 {
+		return
+	}
+	series := m.series(m.routeMetrics(rm.Route, rm.Method), class)
+	series.count.Add(1)
+	series.duration.observe(m.durationBuckets, rm.Duration.Seconds())
+	series.size.observe(m.sizeBuckets, float64(rm.Bytes))
+	series.requestSize.observe(m.sizeBuckets, float64(rm.RequestBytes))
+}
+
+// routeMetrics returns the collectors of a route method, creating them on first use.
+func (m *metricsRegistry) routeMetrics(route, method string) *routeMetrics {
+	key := routeMethod{route, method}
+	m.mu.RLock()
+	rm, ok := m.byKey[key]
+	m.mu.RUnlock()
+	if ok {
+		return rm
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rm, ok := m.byKey[key]; ok {
+		return rm
+	}
+	rm = &routeMetrics{route: route, method: method}
+	m.byKey[key] = rm
+	m.routes = append(m.routes, rm)
+	return rm
+}
+
+// sortedRoutes returns the route collectors sorted by route and method.
+func (m *metricsRegistry) sortedRoutes() []*routeMetrics {
+	m.mu.RLock()
+	routes := append([]*routeMetrics(nil), m.routes...)
+	m.mu.RUnlock()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].route != routes[j].route {
+			return routes[i].route < routes[j].route
+		}
+		return routes[i].method < routes[j].method
+	})
+	return routes
+}
+
+func (m *metricsRegistry) series(rm *routeMetrics, class int) *metricSeries {
+	if s := rm.classes[class].Load(); s != nil {
+		return s
+	}
+	s := &metricSeries{
+		duration: histogram{buckets: make([]atomic.Int64, len(m.durationBuckets)+1)},
+		size:     histogram{buckets: make([]atomic.Int64, len(m.sizeBuckets)+1)},
+
+		requestSize: histogram{buckets: make([]atomic.Int64, len(m.sizeBuckets)+1)},
+	}
+	if !rm.classes[class].CompareAndSwap(nil, s) {
+		return rm.classes[class].Load()
+	}
+	return s
+}
+
+// serveMetrics writes the metrics in the Prometheus text exposition format.
+func (l *LightMux) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m := l.metrics
+	routes := m.sortedRoutes()
+
+	var b strings.Builder
+	b.WriteString("# HELP lightmux_http_requests_in_flight Requests currently being served.\n")
+	b.WriteString("# TYPE lightmux_http_requests_in_flight gauge\n")
+	l.inFlight.mu.Lock()
+	fmt.Fprintf(&b, "lightmux_http_requests_in_flight %d\n", len(l.inFlight.requests))
+	l.inFlight.mu.Unlock()
+
+	b.WriteString("# HELP lightmux_http_requests_total Requests served, by route pattern, method and status class.\n")
+	b.WriteString("# TYPE lightmux_http_requests_total counter\n")
+	eachSeries(routes, func(labels string, s *metricSeries) {
+		fmt.Fprintf(&b, "lightmux_http_requests_total{%s} %d\n", labels, s.count.Load())
+	})
+
+	b.WriteString("# HELP lightmux_http_request_duration_seconds Request duration, by route pattern, method and status class.\n")
+	b.WriteString("# TYPE lightmux_http_request_duration_seconds histogram\n")
+	eachSeries(routes, func(labels string, s *metricSeries) {
+		writeHistogram(&b, "lightmux_http_request_duration_seconds", labels, m.durationBuckets, &s.duration)
+	})
+
+	b.WriteString("# HELP lightmux_http_response_size_bytes Response body size, by route pattern, method and status class.\n")
+	b.WriteString("# TYPE lightmux_http_response_size_bytes histogram\n")
+	eachSeries(routes, func(labels string, s *metricSeries) {
+		writeHistogram(&b, "lightmux_http_response_size_bytes", labels, m.sizeBuckets, &s.size)
+	})
+
+	b.WriteString("# HELP lightmux_http_request_size_bytes Request body size, by route pattern, method and status class.\n")
+	b.WriteString("# TYPE lightmux_http_request_size_bytes histogram\n")
+	eachSeries(routes, func(labels string, s *metricSeries) {
+		writeHistogram(&b, "lightmux_http_request_size_bytes", labels, m.sizeBuckets, &s.requestSize)
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// eachSeries calls fn with the labels of every series that has observations.
+func eachSeries(routes []*routeMetrics, fn func(labels string, s *metricSeries)) {
+	for _, rm := range routes {
+		for class := 1; class <= 5; class++ {
+			if s := rm.classes[class].Load(); s != nil {
+				fn(fmt.Sprintf(`route="%s",method="%s",status="%dxx"`, labelEscaper.Replace(rm.route), rm.method, class), s)
+			}
+		}
+	}
+}
+
+func writeHistogram(b *strings.Builder, name, labels string, bounds []float64, h *histogram) {
+	var cumulative int64
+	for i := range h.buckets {
+		cumulative += h.buckets[i].Load()
+		le := "+Inf"
+		if i < len(bounds) {
+			le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(math.Float64frombits(h.sum.Load()), 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, cumulative)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,128 @@
+package lightmux
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RequestMetric is the measurement of a request served by a route, see MetricsSink.
+type RequestMetric struct {
+	// Route is the route pattern, never the raw path, so cardinality stays bounded.
+	Route    string
+	Method   string
+	Status   int
+	Duration time.Duration
+	// Bytes is the response body size.
+	Bytes int
+	// RequestBytes is the request body size: the Content-Length, or the bytes read for chunked bodies.
+	RequestBytes int64
+}
+
+// MetricsSink receives the measurement of every request served by a route, e.g. to export it to
+// Prometheus (see EnableMetrics), StatsD (see NewStatsDSink) or an OTLP pipeline.
+// ObserveRequest is called on the request goroutine, so it must be fast and safe for concurrent use.
+type MetricsSink interface {
+	ObserveRequest(m RequestMetric)
+}
+
+// MetricsSinkFunc adapts a function to the MetricsSink interface.
+type MetricsSinkFunc func(m RequestMetric)
+
+// ObserveRequest implements MetricsSink.
+func (f MetricsSinkFunc) ObserveRequest(m RequestMetric) {
+	f(m)
+}
+
+// AddMetricsSink sends the measurements of all route requests to sink. It must be called before Run.
+func (l *LightMux) AddMetricsSink(sink MetricsSink) {
+	l.metricsSinks = append(l.metricsSinks, sink)
+}
+
+// sinkObserver returns the route observer feeding the metrics sinks.
+func (l *LightMux) sinkObserver() routeObserver {
+	sinks := l.metricsSinks
+	return func(m RequestMetric) {
+		for _, sink := range sinks {
+			sink.ObserveRequest(m)
+		}
+	}
+}
+
+// StatsDConfig configures a StatsD sink, see NewStatsDSink.
+type StatsDConfig struct {
+	// Addr of the StatsD agent, default: "127.0.0.1:8125".
+	Addr string
+	// Prefix of the metric names, default: "lightmux".
+	Prefix string
+	// Tags sends route, method and status class as DogStatsD tags (Datadog, Telegraf).
+	// Otherwise they are part of the metric name, e.g. "lightmux.users_id.GET.2xx.requests".
+	Tags bool
+}
+
+// StatsDSink sends request counters, timings and body sizes to a StatsD agent over UDP.
+// Send errors are ignored, like StatsD clients usually do.
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+// NewStatsDSink creates a StatsD sink, register it with AddMetricsSink.
+func NewStatsDSink(cfg StatsDConfig) (*StatsDSink, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = "127.0.0.1:8125"
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "lightmux"
+	}
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: statsd: %w", err)
+	}
+	return &StatsDSink{conn: conn, prefix: cfg.Prefix, tags: cfg.Tags}, nil
+}
+
+// ObserveRequest implements MetricsSink.
+func (s *StatsDSink) ObserveRequest(m RequestMetric) {
+	class := fmt.Sprintf("%dxx", m.Status/100)
+	ms := float64(m.Duration) / float64(time.Millisecond)
+
+	var packet string
+	if s.tags {
+		tags := fmt.Sprintf("|#route:%s,method:%s,status:%s", m.Route, m.Method, class)
+		packet = fmt.Sprintf("%[1]s.requests:1|c%[2]s\n%[1]s.request_duration:%[3]g|ms%[2]s\n%[1]s.response_size:%[4]d|h%[2]s\n%[1]s.request_size:%[5]d|h%[2]s",
+			s.prefix, tags, ms, m.Bytes, m.RequestBytes)
+	} else {
+		name := strings.Join([]string{s.prefix, statsDName(m.Route), m.Method, class}, ".")
+		packet = fmt.Sprintf("%[1]s.requests:1|c\n%[1]s.request_duration:%[2]g|ms\n%[1]s.response_size:%[3]d|h\n%[1]s.request_size:%[4]d|h",
+			name, ms, m.Bytes, m.RequestBytes)
+	}
+	s.conn.Write([]byte(packet))
+}
+
+// Close closes the UDP connection.
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// statsDName turns a route pattern into a metric name segment, e.g. "/users/{id}" into "users_id".
+func statsDName(route string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, route)
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
@@ -11,10 +11,32 @@ import (
 // Changes will be applied to server after runnung LightMux.Run func.
 func (l *LightMux) Use(middlewares ...Middleware) {
 	if len(middlewares) != 0 {
-		l.globalMiddlewareStack = append(l.globalMiddlewareStack, middlewares...)
+		l.UseWithPriority(DefaultPriority, middlewares...)
 	}
 }
 
+// namedMiddleware is a middleware registered with UseNamed.
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+// UseNamed registers a named middleware applied to every route, so routes can opt out of it with Route.Skip(name),
+// e.g. login and webhook endpoints skipping "auth". Named middlewares run after the global ones, in registration order,
+// around the route middlewares; requests matching no route do not run them.
+// It panics if the name is empty or already registered.
+func (l *LightMux) UseNamed(name string, middleware Middleware) {
+	if name == "" {
+		panic("middleware name must not be empty")
+	}
+	for _, named := range l.namedMiddlewares {
+		if named.name == name {
+			panic("duplicate middleware name: " + name)
+		}
+	}
+	l.namedMiddlewares = append(l.namedMiddlewares, namedMiddleware{name: name, middleware: middleware})
+}
+
 func chainMiddlewares(handler http.HandlerFunc, middlewares []Middleware) http.HandlerFunc {
 	for i := len(middlewares) - 1; i >= 0; i-- {
 		handler = middlewares[i](handler)
@@ -32,12 +54,32 @@ func (l *LightMux) ApplyGlobalMiddlewares() {
 
 	finalHandler := base
 	if len(l.globalMiddlewareStack) > 0 {
-		finalHandler = chainMiddlewares(base, l.globalMiddlewareStack)
+		finalHandler = chainMiddlewares(base, l.orderedGlobalMiddlewares())
 	}
-	l.server.Handler = finalHandler
+	l.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.serveProbe(w, r) {
+			return
+		}
+		done := l.inFlight.begin(r)
+		defer done()
+		r, info := withRequestInfo(r)
+		info.mux = l
+		if len(l.panicHooks) > 0 {
+			rec := newResponseRecorder(w)
+			w = rec
+			defer l.recoverPanic(rec, r)
+		}
+		if len(l.afterHooks) > 0 {
+			l.runWithAfterHooks(finalHandler, w, r)
+			return
+		}
+		finalHandler(w, r)
+	})
 }
 
 // Prints count of registered middlewares
+//
+// Deprecated: WriteRoutes includes the global middleware count.
 func (l *LightMux) PrintMiddlewareInfo() {
 	fmt.Printf("Global middleware count: %d\n", len(l.globalMiddlewareStack))
 }
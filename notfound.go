@@ -0,0 +1,33 @@
+package lightmux
+
+import "net/http"
+
+// MethodMismatch selects the response for a path that exists, but not with the requested method.
+type MethodMismatch int
+
+const (
+	// RespondMethodNotAllowed answers 405 with an Allow header (default).
+	RespondMethodNotAllowed MethodMismatch = iota
+	// RespondNotFound answers exactly like an unknown path, so sensitive APIs do not reveal
+	// which methods exist. Group and route MethodNotAllowed overrides are not used.
+	RespondNotFound
+)
+
+// SetMethodMismatch selects how the dispatcher answers requests whose path exists with other methods.
+// It must be called before Run.
+func (l *LightMux) SetMethodMismatch(m MethodMismatch) {
+	l.methodMismatch = m
+}
+
+// NotFound sets the handler for unknown paths. It is registered on "/" unless a route owns that path,
+// and is also used for method mismatches with RespondNotFound. Default is http.NotFound.
+func (l *LightMux) NotFound(handler http.HandlerFunc) {
+	l.notFound = handler
+}
+
+func (l *LightMux) notFoundHandler() http.HandlerFunc {
+	if l.notFound != nil {
+		return l.notFound
+	}
+	return http.NotFound
+}
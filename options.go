@@ -0,0 +1,77 @@
+package lightmux
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a LightMux created with New.
+type Option func(l *LightMux)
+
+// New creates a LightMux configured by opts, without the need to build an http.Server first.
+// Options are applied in order, so WithServer should come before options changing the server.
+func New(opts ...Option) *LightMux {
+	l := NewLightMux(&http.Server{})
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithServer uses srv instead of a new http.Server, e.g. to set fields without a dedicated option.
+func WithServer(srv *http.Server) Option {
+	return func(l *LightMux) {
+		l.server = srv
+	}
+}
+
+// WithAddr sets the listen address, default: ":http" (":https" for RunTLS).
+func WithAddr(addr string) Option {
+	return func(l *LightMux) {
+		l.server.Addr = addr
+	}
+}
+
+// WithReadTimeout sets the server ReadTimeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(l *LightMux) {
+		l.server.ReadTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout sets the server ReadHeaderTimeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(l *LightMux) {
+		l.server.ReadHeaderTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the server WriteTimeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(l *LightMux) {
+		l.server.WriteTimeout = d
+	}
+}
+
+// WithIdleTimeout sets the server IdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(l *LightMux) {
+		l.server.IdleTimeout = d
+	}
+}
+
+// WithLogger sends lifecycle messages (startup, shutdown, reloads) and server errors to logger
+// instead of the standard logger, e.g. a *slog.Logger or StdLogger(log.New(...)).
+func WithLogger(logger Logger) Option {
+	return func(l *LightMux) {
+		l.logger = logger
+		l.server.ErrorLog = errorLog(logger)
+	}
+}
+
+// WithShutdownTimeout sets the graceful shutdown timeout, see SetShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(l *LightMux) {
+		l.SetShutdownTimeout(d)
+	}
+}
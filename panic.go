@@ -0,0 +1,40 @@
+package lightmux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// OnPanic registers a hook called when a handler or middleware panics, e.g. to forward the panic
+// to an error tracking service. Registering a hook enables the recovery layer: the panic is recovered,
+// hooks are called in registration order with the recovered value and stack trace, and a 500 response
+// is written through Error. If the response was already started, the error is only reported through
+// ReportError. http.ErrAbortHandler is passed on, as it aborts the response on purpose.
+func (l *LightMux) OnPanic(hook func(r *http.Request, recovered any, stack []byte)) {
+	l.panicHooks = append(l.panicHooks, hook)
+}
+
+// recoverPanic is deferred by the server handler when panic hooks are registered.
+func (l *LightMux) recoverPanic(w *responseRecorder, r *http.Request) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+		panic(recovered)
+	}
+
+	stack := debug.Stack()
+	for _, hook := range l.panicHooks {
+		hook(r, recovered, stack)
+	}
+	err := fmt.Errorf("panic: %v", recovered)
+	if w.wroteHeader {
+		// the status is sent and the body may be partial, an error body would corrupt it
+		ReportError(r, http.StatusInternalServerError, err)
+		return
+	}
+	Error(w, r, http.StatusInternalServerError, err)
+}
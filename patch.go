@@ -0,0 +1,475 @@
+package lightmux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MergePatchContentType is the media type of JSON Merge Patch documents (RFC 7386).
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is the media type of JSON Patch documents (RFC 6902).
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// MaxPatchBodySize limits the size of PATCH bodies read by ApplyPatch.
+var MaxPatchBodySize int64 = 1 << 20
+
+// ErrUnsupportedPatchType is returned by ApplyPatch for Content-Types other than the patch media types,
+// handlers usually answer it with 415 Unsupported Media Type.
+var ErrUnsupportedPatchType = errors.New("unsupported patch content type")
+
+// PatchError describes an invalid or failed JSON Patch operation.
+type PatchError struct {
+	Index int    // index of the operation in the patch document
+	Op    string // operation name
+	Path  string // target JSON Pointer
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// Validator is implemented by patch targets that validate themselves after a patch was applied.
+type Validator interface {
+	Validate() error
+}
+
+// ApplyPatch reads the PATCH body of r and applies it to target, a pointer to a struct or map,
+// choosing JSON Merge Patch or JSON Patch by the request Content-Type.
+// The patched document is decoded into a copy of target rejecting unknown fields, validated when
+// it implements Validator, and only then stored into target, so target is untouched on error.
+// Struct fields invisible to JSON (unexported or tagged "-") keep their values.
+func ApplyPatch(r *http.Request, target any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != MergePatchContentType && mediaType != JSONPatchContentType {
+		return fmt.Errorf("%w: %q", ErrUnsupportedPatchType, mediaType)
+	}
+
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(r.Body, MaxPatchBodySize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(patch)) > MaxPatchBodySize {
+		return fmt.Errorf("patch body exceeds %d bytes", MaxPatchBodySize)
+	}
+
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	if mediaType == MergePatchContentType {
+		doc, err = ApplyMergePatch(doc, patch)
+	} else {
+		doc, err = ApplyJSONPatch(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	patched := newPatchTarget(rv.Elem())
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patched.Interface()); err != nil {
+		return fmt.Errorf("patched document does not match target: %w", err)
+	}
+
+	if v, ok := patched.Interface().(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
+	rv.Elem().Set(patched.Elem())
+	return nil
+}
+
+// newPatchTarget returns a pointer to the value the patched document is decoded into. For structs it is a copy
+// of current with all JSON fields zeroed, so members removed by the patch are cleared while unexported and
+// "-" fields are kept. Other values start from zero, since decoding into a map merges keys.
+func newPatchTarget(current reflect.Value) reflect.Value {
+	patched := reflect.New(current.Type())
+	if current.Kind() == reflect.Struct {
+		patched.Elem().Set(current)
+		zeroJSONFields(patched.Elem())
+	}
+	return patched
+}
+
+// zeroJSONFields zeroes the exported fields of struct v that encoding/json reads and writes.
+func zeroJSONFields(v reflect.Value) {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			zeroJSONFields(v.Field(i))
+			continue
+		}
+		v.Field(i).SetZero()
+	}
+}
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7386) to doc and returns the result.
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if err := decodeJSON(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) to doc and returns the result.
+// Operations are applied in order and the whole patch fails if any operation fails.
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	var target any
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		target, err = applyOperation(target, op)
+		if err != nil {
+			path := ""
+			if op.Path != nil {
+				path = *op.Path
+			}
+			return nil, &PatchError{Index: i, Op: op.Op, Path: path, Err: err}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(doc any, op patchOperation) (any, error) {
+	if op.Path == nil {
+		return nil, errors.New("missing path")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		var v any
+		return v, decodeJSON(op.Value, &v)
+	}
+	from := func() ([]string, error) {
+		if op.From == nil {
+			return nil, errors.New("missing from")
+		}
+		return parsePointer(*op.From)
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+
+	case "remove":
+		return pointerRemove(doc, path)
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			// replacing the whole document
+			return v, nil
+		}
+		if doc, err = pointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+
+	case "move":
+		src, err := from()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		v, err := pointerGet(doc, src)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = pointerRemove(doc, src); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+
+	case "copy":
+		src, err := from()
+		if err != nil {
+			return nil, err
+		}
+		v, err := pointerGet(doc, src)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = deepCopyJSON(v); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, v) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			v, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate applies fn to the container holding the last token of path and returns the updated document.
+func pointerUpdate(doc any, path []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerUpdate(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := doc.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		i, _ := arrayIndex(path[0], len(container)-1)
+		container[i] = child
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar value", token)
+		}
+	})
+}
+
+func pointerRemove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return pointerUpdate(doc, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar value", token)
+		}
+	})
+}
+
+// arrayIndex parses an array index token, which must be between 0 and max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("array index %q out of range", token)
+	}
+	return i, nil
+}
+
+// decodeJSON decodes data keeping numbers as json.Number, so patching does not lose precision.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func deepCopyJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var c any
+	return c, decodeJSON(data, &c)
+}
+
+// jsonEqual compares decoded JSON values, treating numbers with the same value as equal.
+func jsonEqual(a, b any) bool {
+	na, aok := a.(json.Number)
+	nb, bok := b.(json.Number)
+	if aok && bok {
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,28 @@
+package lightmux
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// EnablePprof registers the net/http/pprof handlers under prefix (e.g. "/debug/pprof") as routes,
+// so they show up in WriteRoutes and pass through middlewares, e.g. authentication.
+// The endpoints are protected by the admin guard if set, middlewares run after it.
+func (l *LightMux) EnablePprof(prefix string, middlewares ...Middleware) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	l.adminRoute(prefix+"/{$}", middlewares...).Handle(http.MethodGet, pprof.Index)
+	l.adminRoute(prefix+"/cmdline", middlewares...).Handle(http.MethodGet, pprof.Cmdline)
+	l.adminRoute(prefix+"/profile", middlewares...).Handle(http.MethodGet, pprof.Profile)
+	l.adminRoute(prefix+"/trace", middlewares...).Handle(http.MethodGet, pprof.Trace)
+
+	symbol := l.adminRoute(prefix+"/symbol", middlewares...)
+	symbol.Handle(http.MethodGet, pprof.Symbol)
+	symbol.Handle(http.MethodPost, pprof.Symbol)
+
+	// pprof.Index only resolves named profiles under /debug/pprof/, so they get their own route
+	l.adminRoute(prefix+"/{profile}", middlewares...).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(r.PathValue("profile")).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,76 @@
+package lightmux
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is returned by CheckPreconditions when If-Match or If-Unmodified-Since fails.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// CheckPreconditions evaluates the If-Match and If-Unmodified-Since request headers against the
+// current state of the resource, following RFC 9110 section 13.2.2: If-Unmodified-Since is only
+// evaluated when If-Match is absent. An empty currentETag means the resource does not exist,
+// a zero modTime skips the If-Unmodified-Since check.
+// It returns ErrPreconditionFailed when the update must be rejected with 412.
+func CheckPreconditions(r *http.Request, currentETag string, modTime time.Time) error {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, currentETag) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !modTime.IsZero() {
+		since, err := http.ParseTime(ius)
+		if err != nil {
+			return nil // invalid dates are ignored
+		}
+		if modTime.Truncate(time.Second).After(since) {
+			return ErrPreconditionFailed
+		}
+	}
+
+	return nil
+}
+
+// EnforcePreconditions runs CheckPreconditions and writes a 412 response through Error when it fails.
+// It reports whether the handler may proceed.
+func EnforcePreconditions(w http.ResponseWriter, r *http.Request, currentETag string, modTime time.Time) bool {
+	if err := CheckPreconditions(r, currentETag, modTime); err != nil {
+		Error(w, r, http.StatusPreconditionFailed, err)
+		return false
+	}
+	return true
+}
+
+// ETag returns a strong entity tag for data, ready to be used in the ETag header.
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagListMatches reports whether the If-Match header value matches current using strong comparison.
+func etagListMatches(header, current string) bool {
+	if current == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strings.HasPrefix(current, "W/") {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, "W/") && tag == current {
+			return true
+		}
+	}
+	return false
+}
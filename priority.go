@@ -0,0 +1,44 @@
+package lightmux
+
+import "sort"
+
+// Middleware phases for UseWithPriority. Lower priorities run first (outermost),
+// middlewares with equal priority run in registration order.
+const (
+	// PhasePreRouting is for middlewares that must see every request first, e.g. RealIP, RequestIDMiddleware, RequestLogger.
+	PhasePreRouting = 100
+	// PhasePreAuth is for middlewares running before authentication, e.g. CORS, SecurityHeaders, RateLimiter.
+	PhasePreAuth = 200
+	// PhaseAuth is for authentication and authorization middlewares.
+	PhaseAuth = 300
+	// PhasePostAuth is for middlewares relying on an authenticated request, e.g. per-user rate limits or auditing.
+	PhasePostAuth = 400
+	// DefaultPriority is used by Use.
+	DefaultPriority = 500
+)
+
+// UseWithPriority registers global middlewares with an explicit priority (see the Phase constants),
+// so the global order does not depend on the call order across scattered init functions.
+func (l *LightMux) UseWithPriority(priority int, middlewares ...Middleware) {
+	for _, mw := range middlewares {
+		l.globalMiddlewareStack = append(l.globalMiddlewareStack, mw)
+		l.globalPriorities = append(l.globalPriorities, priority)
+	}
+}
+
+// orderedGlobalMiddlewares returns the global middlewares sorted by priority, outermost first.
+func (l *LightMux) orderedGlobalMiddlewares() []Middleware {
+	order := make([]int, len(l.globalMiddlewareStack))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return l.globalPriorities[order[a]] < l.globalPriorities[order[b]]
+	})
+
+	ordered := make([]Middleware, len(order))
+	for i, index := range order {
+		ordered[i] = l.globalMiddlewareStack[index]
+	}
+	return ordered
+}
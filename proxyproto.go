@@ -0,0 +1,187 @@
+package lightmux
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature starts PROXY protocol v2 headers.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyProtocolConfig configures PROXY protocol parsing, see EnableProxyProtocol.
+type ProxyProtocolConfig struct {
+	// TrustedProxies lists networks of load balancers allowed to send PROXY headers, e.g. "10.0.0.0/8".
+	// Connections from other peers are served unchanged.
+	TrustedProxies []string
+	// Optional accepts connections from trusted proxies without a PROXY header instead of closing them.
+	Optional bool
+	// HeaderTimeout bounds reading the header, default: 5 seconds.
+	HeaderTimeout time.Duration
+}
+
+// EnableProxyProtocol parses PROXY protocol v1 and v2 headers (HAProxy, AWS NLB) on connections from trusted
+// proxies, so RemoteAddr, ClientIP and logs reflect the real client. It panics on invalid CIDRs.
+func (l *LightMux) EnableProxyProtocol(cfg ProxyProtocolConfig) {
+	trusted := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, cidr := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy CIDR %q: %v", cidr, err))
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	if cfg.HeaderTimeout <= 0 {
+		cfg.HeaderTimeout = 5 * time.Second
+	}
+	l.proxyProto = &proxyProtocol{cfg: cfg, trusted: trusted}
+}
+
+type proxyProtocol struct {
+	cfg     ProxyProtocolConfig
+	trusted []netip.Prefix
+}
+
+// wrap returns c reading the PROXY header if its peer is a trusted proxy.
+func (p *proxyProtocol) wrap(c net.Conn) net.Conn {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil || !ipAllowed(host, p.trusted) {
+		return c
+	}
+	return &proxyConn{Conn: c, r: bufio.NewReader(c), proto: p}
+}
+
+// proxyConn reads the PROXY header lazily, on the connection goroutine of the server instead of Accept.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	proto  *proxyProtocol
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.proto.cfg.HeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r, c.proto.cfg.Optional)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header and returns the client address,
+// nil for LOCAL or UNKNOWN connections and, with optional, for connections without header.
+func readProxyHeader(r *bufio.Reader, optional bool) (net.Addr, error) {
+	start, err := r.Peek(5)
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: PROXY header: %w", err)
+	}
+	switch {
+	case string(start) == "PROXY":
+		return readProxyV1(r)
+	case bytes.Equal(start, proxyV2Signature[:5]):
+		return readProxyV2(r)
+	case optional:
+		return nil, nil
+	default:
+		return nil, errors.New("lightmux: PROXY header missing")
+	}
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// The longest v1 header is 107 bytes including CRLF
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("lightmux: PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("lightmux: PROXY v1 header too long")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("lightmux: invalid PROXY v1 header %q", line)
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: invalid PROXY v1 source address: %w", err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: invalid PROXY v1 source port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("lightmux: PROXY v2 header: %w", err)
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, errors.New("lightmux: invalid PROXY v2 header")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("lightmux: PROXY v2 header: %w", err)
+	}
+
+	// LOCAL connections (health checks of the proxy itself) keep the real peer address
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // AF_INET: source, destination addresses and ports
+		if len(body) < 12 {
+			return nil, errors.New("lightmux: short PROXY v2 IPv4 address block")
+		}
+		ip := netip.AddrFrom4([4]byte(body[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[8:10]))), nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("lightmux: short PROXY v2 IPv6 address block")
+		}
+		ip := netip.AddrFrom16([16]byte(body[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[32:34]))), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,167 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is passed to Error when the RateLimiter rejects a request.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit describes a token bucket: Rate tokens are added every Per, up to Burst tokens.
+type RateLimit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int // bucket capacity, default: Rate
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int           // bucket capacity
+	Remaining int           // tokens left after the request
+	Reset     time.Duration // time until the next token when exhausted, otherwise until the bucket is full
+}
+
+// RateLimitStore keeps token buckets by client key.
+// Implementations backed by external systems (e.g. Redis) allow limits shared between instances.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitConfig configures the RateLimiter middleware.
+type RateLimitConfig struct {
+	Limit RateLimit
+	// Store keeps the buckets, default: a new MemoryRateLimitStore.
+	Store RateLimitStore
+	// KeyFunc extracts the client key, default: ClientIP.
+	KeyFunc func(r *http.Request) string
+	// Prefix namespaces the keys, needed when several limiters share one store.
+	Prefix string
+	// OnLimited overrides the default response, which calls lightmux.Error with 429 and ErrRateLimited.
+	// Rate limit headers are already set.
+	OnLimited http.HandlerFunc
+	// Logger receives store errors, default: the Logger of the LightMux (see WithLogger).
+	Logger Logger
+}
+
+// RateLimiter returns a token bucket rate limiting middleware.
+// Each returned middleware has its own limit, so it can be applied per route or per group.
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// limited requests are answered with 429 and Retry-After. Store errors let the request through.
+func RateLimiter(cfg RateLimitConfig) Middleware {
+	if cfg.Limit.Rate <= 0 || cfg.Limit.Per <= 0 {
+		panic("rate limit must have positive Rate and Per")
+	}
+	if cfg.Limit.Burst <= 0 {
+		cfg.Limit.Burst = cfg.Limit.Rate
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore()
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = ClientIP
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			res, err := cfg.Store.Take(r.Context(), cfg.Prefix+cfg.KeyFunc(r), cfg.Limit)
+			if err != nil {
+				loggerOr(cfg.Logger, r).Error("rate limit store", "error", err)
+				next(w, r)
+				return
+			}
+
+			reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", reset)
+
+			if res.Allowed {
+				next(w, r)
+				return
+			}
+
+			h.Set("Retry-After", reset)
+			if cfg.OnLimited != nil {
+				cfg.OnLimited(w, r)
+				return
+			}
+			Error(w, r, http.StatusTooManyRequests, ErrRateLimited)
+		}
+	}
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Idle buckets are swept periodically.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	perToken := limit.Per / time.Duration(limit.Rate)
+	capacity := float64(limit.Burst)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	res := RateLimitResult{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	}
+	res.Remaining = int(b.tokens)
+
+	if b.tokens < 1 {
+		res.Reset = time.Duration((1 - b.tokens) * float64(perToken))
+	} else {
+		res.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	}
+
+	if now.Sub(s.lastSweep) > limit.Per*time.Duration(limit.Burst) {
+		s.sweep(now, perToken, capacity)
+	}
+
+	return res, nil
+}
+
+// sweep drops buckets that have refilled completely, they are equivalent to missing ones.
+func (s *MemoryRateLimitStore) sweep(now time.Time, perToken time.Duration, capacity float64) {
+	for key, b := range s.buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(perToken) >= capacity {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,115 @@
+package lightmux
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPCtxKey struct{}
+
+// RealIPConfig configures the RealIP middleware.
+type RealIPConfig struct {
+	// TrustedProxies lists networks of proxies allowed to set forwarding headers, e.g. "10.0.0.0/8".
+	// Headers sent by other peers are ignored.
+	TrustedProxies []string
+	// Headers are checked in order, default: X-Forwarded-For, X-Real-IP, Forwarded.
+	Headers []string
+}
+
+// RealIP returns a middleware resolving the client IP from forwarding headers when the peer is a trusted proxy.
+// For X-Forwarded-For and Forwarded the rightmost address that is not a trusted proxy is used, so spoofed
+// entries prepended by the client are skipped. The result is available through ClientIP.
+// It panics on invalid CIDRs.
+func RealIP(cfg RealIPConfig) Middleware {
+	trusted := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, cidr := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy CIDR %q: %v", cidr, err))
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = []string{"X-Forwarded-For", "X-Real-IP", "Forwarded"}
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteIP(r)
+			if ipAllowed(ip, trusted) {
+				for _, header := range cfg.Headers {
+					if forwarded := forwardedIP(r.Header.Values(header), header, trusted); forwarded != "" {
+						ip = forwarded
+						break
+					}
+				}
+			}
+
+			if info := requestInfoFrom(r.Context()); info != nil {
+				info.clientIP = ip
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), clientIPCtxKey{}, ip)))
+		}
+	}
+}
+
+// ClientIP returns the client IP resolved by RealIP, or the host part of r.RemoteAddr.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtxKey{}).(string); ok {
+		return ip
+	}
+	if info := requestInfoFrom(r.Context()); info != nil && info.clientIP != "" {
+		return info.clientIP
+	}
+	return remoteIP(r)
+}
+
+// forwardedIP returns the rightmost untrusted address of the header values, or an empty string.
+func forwardedIP(values []string, header string, trusted []netip.Prefix) string {
+	var addrs []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(header, "Forwarded") {
+				part = forwardedFor(part)
+			}
+			if part = strings.TrimSpace(part); part != "" {
+				addrs = append(addrs, part)
+			}
+		}
+	}
+
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, err := parseForwardedAddr(addrs[i])
+		if err != nil {
+			return ""
+		}
+		if i > 0 && ipAllowed(addr.String(), trusted) {
+			continue
+		}
+		return addr.String()
+	}
+	return ""
+}
+
+// forwardedFor returns the for= parameter of a Forwarded header element (RFC 7239).
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(key, "for") {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// parseForwardedAddr parses an IP optionally carrying a port or IPv6 brackets.
+func parseForwardedAddr(s string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	return addr.Unmap(), err
+}
@@ -0,0 +1,88 @@
+package lightmux
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// acmeChallengePrefix is the path of ACME HTTP-01 challenges, which must be answered over plain HTTP.
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// HTTPSRedirectConfig configures HTTP to HTTPS redirects, see HTTPSRedirect and LightMux.RedirectHTTP.
+type HTTPSRedirectConfig struct {
+	// Addr of the plain HTTP listener started by RunTLS, default: ":http".
+	Addr string
+	// HTTPSPort is the port of redirect targets, empty omits it (default HTTPS port 443).
+	HTTPSPort string
+	// ACMEHandler answers ACME HTTP-01 challenges (e.g. autocert.Manager.HTTPHandler(nil)),
+	// nil redirects them like any other request.
+	ACMEHandler http.Handler
+	// TrustForwardedProto treats requests with "X-Forwarded-Proto: https" as secure,
+	// for deployments behind a TLS terminating proxy.
+	TrustForwardedProto bool
+}
+
+// HTTPSRedirect returns a middleware redirecting plain HTTP requests to HTTPS:
+// 301 for GET and HEAD, 308 for other methods so bodies are resent.
+func HTTPSRedirect(cfg HTTPSRedirectConfig) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			secure := r.TLS != nil || (cfg.TrustForwardedProto && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"))
+			if secure {
+				next(w, r)
+				return
+			}
+			if cfg.ACMEHandler != nil && strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+				cfg.ACMEHandler.ServeHTTP(w, r)
+				return
+			}
+			redirectToHTTPS(w, r, cfg.HTTPSPort)
+		}
+	}
+}
+
+// RedirectHTTP makes RunTLS also listen on cfg.Addr with plain HTTP, answering every request with
+// a redirect to the TLS listener (ACME challenges excepted). The listener starts and shuts down with the server.
+// It is not started in degraded TLSFallbackHTTP mode.
+func (l *LightMux) RedirectHTTP(cfg HTTPSRedirectConfig) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":http"
+	}
+	l.httpsRedirect = &cfg
+}
+
+// addHTTPSRedirectListener registers the redirect listener configured with RedirectHTTP as an additional
+// listener, so it binds, fails and shuts down together with the TLS listener.
+func (l *LightMux) addHTTPSRedirectListener() {
+	if l.httpsRedirect == nil {
+		return
+	}
+	cfg := *l.httpsRedirect
+	l.listeners = append(l.listeners, &extraListener{
+		cfg:     ListenerConfig{Addr: cfg.Addr},
+		handler: HTTPSRedirect(cfg)(func(w http.ResponseWriter, r *http.Request) {}),
+		server:  &http.Server{},
+	})
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request, port string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		// a bracketed IPv6 host without port, e.g. "[::1]"
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
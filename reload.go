@@ -0,0 +1,106 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// reloader runs reload hooks, either on SIGHUP while the server runs or through LightMux.Reload.
+type reloader struct {
+	mu    sync.Mutex
+	hooks []func() error
+	stop  chan struct{}
+}
+
+// OnReload registers a hook re-reading configuration (redirect maps, allowlists, rate limits, templates...).
+// Hooks run in registration order when the process receives SIGHUP while Run is active, or when Reload is called.
+// Hooks should build the new state first and swap it atomically (see Reloadable), so requests never see partial state.
+func (l *LightMux) OnReload(hook func() error) {
+	l.reload.mu.Lock()
+	first := len(l.reload.hooks) == 0
+	l.reload.hooks = append(l.reload.hooks, hook)
+	l.reload.mu.Unlock()
+
+	if first {
+		l.onStart(l.watchReloadSignal)
+		l.onStop(l.stopReloadSignal)
+	}
+}
+
+// Reload runs all reload hooks and returns their joined errors. A failing hook does not prevent the others from running.
+func (l *LightMux) Reload() error {
+	l.reload.mu.Lock()
+	defer l.reload.mu.Unlock()
+
+	var errs []error
+	for _, hook := range l.reload.hooks {
+		if err := hook(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *LightMux) watchReloadSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	stop := make(chan struct{})
+	l.reload.stop = stop
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-sigCh:
+				l.logger.Info("SIGHUP received, reloading configuration...")
+				if err := l.Reload(); err != nil {
+					l.logger.Error("reload failed", "error", err)
+				} else {
+					l.logger.Info("Reload complete.")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (l *LightMux) stopReloadSignal(context.Context) error {
+	if l.reload.stop != nil {
+		close(l.reload.stop)
+		l.reload.stop = nil
+	}
+	return nil
+}
+
+// Reloadable holds a value that can be swapped atomically by reload hooks while requests read it.
+type Reloadable[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// NewReloadable creates a Reloadable holding v.
+func NewReloadable[T any](v T) *Reloadable[T] {
+	r := &Reloadable[T]{}
+	r.Store(v)
+	return r
+}
+
+// Load returns the current value.
+func (r *Reloadable[T]) Load() T {
+	if p := r.p.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// Store atomically replaces the current value.
+func (r *Reloadable[T]) Store(v T) {
+	r.p.Store(&v)
+}
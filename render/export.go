@@ -0,0 +1,106 @@
+package render
+
+import (
+	"encoding/csv"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+)
+
+// XLSXContentType is the media type of Excel workbooks, to be used with Sheet and an XLSX SheetWriter.
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// FlushEvery is the number of rows after which streamed exports are flushed to the client.
+// Values below 1 flush every row.
+var FlushEvery = 500
+
+// flushDue reports whether the stream is flushed after the nth row.
+func flushDue(n int) bool {
+	return n%max(FlushEvery, 1) == 0
+}
+
+// SheetWriter writes tabular rows into a document. Adapters around XLSX libraries implement it
+// to stream spreadsheets through Sheet.
+type SheetWriter interface {
+	WriteRow(cells []string) error
+	// Close finishes the document, writing any trailing data.
+	Close() error
+}
+
+// SheetFlusher is optionally implemented by SheetWriters able to push buffered rows to the underlying writer.
+type SheetFlusher interface {
+	Flush() error
+}
+
+// NewSheetWriter creates a SheetWriter writing a document to w.
+type NewSheetWriter func(w io.Writer) (SheetWriter, error)
+
+// CSV streams rows as a CSV attachment named filename, preceded by the headers row.
+// Rows are flushed to the client every FlushEvery rows, so large reports are never buffered entirely.
+// An error yielded by rows stops the export; as the response is already committed, it is only returned.
+func CSV(w http.ResponseWriter, filename string, headers []string, rows iter.Seq2[[]string, error]) error {
+	return Sheet(w, filename, "text/csv; charset=utf-8", newCSVSheetWriter, headers, rows)
+}
+
+// Sheet streams rows as an attachment named filename using a SheetWriter created by newWriter.
+func Sheet(w http.ResponseWriter, filename, contentType string, newWriter NewSheetWriter, headers []string, rows iter.Seq2[[]string, error]) error {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	h.Set("Cache-Control", "no-store")
+
+	sheet, err := newWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		if err := sheet.WriteRow(headers); err != nil {
+			return err
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	n := 0
+	for row, err := range rows {
+		if err != nil {
+			return err
+		}
+		if err := sheet.WriteRow(row); err != nil {
+			return err
+		}
+
+		if n++; flushDue(n) {
+			if f, ok := sheet.(SheetFlusher); ok {
+				if err := f.Flush(); err != nil {
+					return err
+				}
+			}
+			rc.Flush()
+		}
+	}
+
+	return sheet.Close()
+}
+
+type csvSheetWriter struct {
+	w *csv.Writer
+}
+
+func newCSVSheetWriter(w io.Writer) (SheetWriter, error) {
+	return &csvSheetWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (s *csvSheetWriter) WriteRow(cells []string) error {
+	return s.w.Write(cells)
+}
+
+func (s *csvSheetWriter) Flush() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvSheetWriter) Close() error {
+	return s.Flush()
+}
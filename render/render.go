@@ -0,0 +1,31 @@
+// Package render provides response rendering helpers integrated with lightmux error handling.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ayayaakasvin/lightmux"
+)
+
+// JSON writes v as a JSON response with the given status code.
+// The payload is encoded into a buffer before anything is sent, so encoding failures
+// (unsupported types, channels, marshaler errors) are written through lightmux.Error
+// as a well-formed error response instead of a half-written body.
+func JSON(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		err = fmt.Errorf("render: encode JSON: %w", err)
+		lightmux.Error(w, r, http.StatusInternalServerError, err)
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,105 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayayaakasvin/lightmux"
+)
+
+func TestJSONEncodeFailure(t *testing.T) {
+
+	var reported error
+
+	lmux := lightmux.NewLightMux(&http.Server{})
+	lmux.OnError(func(r *http.Request, status int, err error) {
+		reported = err
+	})
+	lmux.NewRoute("/bad").Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, r, http.StatusOK, map[string]any{"ok": true, "ch": make(chan int)})
+	})
+	lmux.ApplyRoutes()
+
+	w := httptest.NewRecorder()
+	lmux.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bad", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "{\"error\":\"Internal Server Error\"}\n" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+	if reported == nil {
+		t.Fatal("OnError hook was not called")
+	}
+}
+
+func TestJSON(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := JSON(w, r, http.StatusCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusCreated || w.Body.String() != "{\"id\":1}\n" || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCSV(t *testing.T) {
+
+	rows := func(yield func([]string, error) bool) {
+		for _, row := range [][]string{{"1", "ann"}, {"2", "bob, jr"}} {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := CSV(w, "users report.csv", []string{"id", "name"}, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Body.String() != "id,name\n1,ann\n2,\"bob, jr\"\n" ||
+		w.Header().Get("Content-Disposition") != `attachment; filename="users report.csv"` {
+		t.Fatalf("unexpected export: %q %v", w.Body.String(), w.Header())
+	}
+	defer func(flushEvery int) { FlushEvery = flushEvery }(FlushEvery)
+	FlushEvery = 0
+	w = httptest.NewRecorder()
+	if err := CSV(w, "users.csv", []string{"id", "name"}, rows); err != nil || !w.Flushed {
+		t.Fatalf("expected a zero FlushEvery to flush every row, got %v", err)
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+
+	items := make(chan map[string]int)
+	go func() {
+		defer close(items)
+		for i := range 3 {
+			items <- map[string]int{"id": i}
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := JSONArrayChan(w, r, items); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]int
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 3 || got[2]["id"] != 2 {
+		t.Fatalf("unexpected array %q: %v", w.Body.String(), err)
+	}
+
+	failing := func(yield func(int, error) bool) {
+		yield(0, errors.New("query failed"))
+	}
+	w = httptest.NewRecorder()
+	if err := JSONArray(w, r, failing); err == nil || w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected error response before commit, got %d", w.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+
+	"github.com/ayayaakasvin/lightmux"
+)
+
+// FlushBytes is the buffer size of streamed JSON arrays; the buffer is sent to the client whenever it fills up.
+var FlushBytes = 32 << 10
+
+// JSONArray streams items as a single JSON array, flushing every FlushEvery items or FlushBytes bytes,
+// so large list endpoints never buffer entire result sets. Items are pulled only after the previous ones
+// were written, so a slow client slows down the producer instead of growing memory.
+// Errors before the first flush (yielded by items or encoding) are written through lightmux.Error;
+// later ones can only be returned as the response is committed. The stream stops when the request context is done.
+func JSONArray[T any](w http.ResponseWriter, r *http.Request, items iter.Seq2[T, error]) error {
+	cw := &commitWriter{w: w}
+	bw := bufio.NewWriterSize(cw, FlushBytes)
+	enc := json.NewEncoder(bw)
+	rc := http.NewResponseController(w)
+	ctx := r.Context()
+
+	fail := func(err error) error {
+		if !cw.committed {
+			lightmux.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	bw.WriteByte('[')
+
+	n := 0
+	for item, err := range items {
+		if err != nil {
+			return fail(err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		if err := enc.Encode(item); err != nil {
+			return fail(fmt.Errorf("render: encode JSON: %w", err))
+		}
+
+		if n++; flushDue(n) {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// JSONArrayChan streams the values received from items as a single JSON array until the channel is closed
+// or the request context is done, see JSONArray.
+func JSONArrayChan[T any](w http.ResponseWriter, r *http.Request, items <-chan T) error {
+	ctx := r.Context()
+	return JSONArray(w, r, func(yield func(T, error) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-items:
+				if !ok || !yield(item, nil) {
+					return
+				}
+			}
+		}
+	})
+}
+
+// commitWriter records whether anything was written to the response.
+type commitWriter struct {
+	w         http.ResponseWriter
+	committed bool
+}
+
+func (c *commitWriter) Write(p []byte) (int, error) {
+	c.committed = true
+	return c.w.Write(p)
+}
@@ -0,0 +1,75 @@
+package lightmux
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the header carrying request IDs.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits incoming request IDs, longer ones are replaced.
+const maxRequestIDLength = 128
+
+type requestIDCtxKey struct{}
+
+// RequestIDConfig configures the RequestIDMiddleware.
+type RequestIDConfig struct {
+	// Header carrying the request ID, default: X-Request-ID.
+	Header string
+	// IgnoreIncoming always generates a new ID instead of reusing a valid incoming one.
+	IgnoreIncoming bool
+	// Generator of new IDs, default: RandomID(). Use UUIDv7, ULID or Snowflake for time-sortable IDs.
+	Generator IDGenerator
+}
+
+// RequestIDMiddleware returns a middleware that reads the request ID from the incoming header
+// or generates a new one, stores it in the request context and echoes it in the response header.
+// Incoming IDs longer than 128 characters or containing non-printable characters are replaced.
+func RequestIDMiddleware(cfg RequestIDConfig) Middleware {
+	if cfg.Header == "" {
+		cfg.Header = DefaultRequestIDHeader
+	}
+	if cfg.Generator == nil {
+		cfg.Generator = RandomID()
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(cfg.Header)
+			if cfg.IgnoreIncoming || !validRequestID(id) {
+				id = cfg.Generator.NewID()
+			}
+
+			if info := requestInfoFrom(r.Context()); info != nil {
+				info.requestID = id
+			}
+			w.Header().Set(cfg.Header, id)
+
+			next(w, r.WithContext(context.WithValue(r.Context(), requestIDCtxKey{}, id)))
+		}
+	}
+}
+
+// RequestID returns the ID assigned by RequestIDMiddleware, or an empty string.
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDCtxKey{}).(string); ok {
+		return id
+	}
+	if info := requestInfoFrom(r.Context()); info != nil {
+		return info.requestID
+	}
+	return ""
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
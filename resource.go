@@ -0,0 +1,121 @@
+package lightmux
+
+import "net/http"
+
+// ResourceAction names a conventional CRUD action of a resource controller.
+type ResourceAction string
+
+const (
+	ActionIndex  ResourceAction = "Index"  // GET    /path
+	ActionCreate ResourceAction = "Create" // POST   /path
+	ActionShow   ResourceAction = "Show"   // GET    /path/{id}
+	ActionUpdate ResourceAction = "Update" // PUT    /path/{id}, PATCH /path/{id}
+	ActionDelete ResourceAction = "Delete" // DELETE /path/{id}
+)
+
+// ResourceIDParam is the wildcard name of resource member routes, read it with r.PathValue(ResourceIDParam).
+const ResourceIDParam = "id"
+
+// Indexer is implemented by resource controllers that list the collection.
+type Indexer interface {
+	Index(w http.ResponseWriter, r *http.Request)
+}
+
+// Creator is implemented by resource controllers that create collection members.
+type Creator interface {
+	Create(w http.ResponseWriter, r *http.Request)
+}
+
+// Shower is implemented by resource controllers that show a single member.
+type Shower interface {
+	Show(w http.ResponseWriter, r *http.Request)
+}
+
+// Updater is implemented by resource controllers that update a single member.
+type Updater interface {
+	Update(w http.ResponseWriter, r *http.Request)
+}
+
+// Deleter is implemented by resource controllers that delete a single member.
+type Deleter interface {
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+// ActionMiddlewarer is optionally implemented by resource controllers to attach middlewares to specific actions.
+// They run after group and route middlewares, right before the action handler.
+type ActionMiddlewarer interface {
+	ActionMiddlewares(action ResourceAction) []Middleware
+}
+
+// Resource holds the routes created for a resource controller.
+// A route is nil if the controller implements none of its actions.
+type Resource struct {
+	Collection *Route // path
+	Member     *Route // path/{id}
+}
+
+// Resource maps the methods implemented by controller (Index, Show, Create, Update, Delete)
+// onto conventional routes and HTTP methods under the group prefix.
+// It panics if the controller implements none of the actions.
+func (g *RouteGroup) Resource(path string, controller any, middlewares ...Middleware) *Resource {
+	return newResource(g, path, controller, middlewares)
+}
+
+// Resource is the LightMux counterpart of RouteGroup.Resource for resources without a group.
+func (l *LightMux) Resource(path string, controller any, middlewares ...Middleware) *Resource {
+	return newResource(l, path, controller, middlewares)
+}
+
+func newResource(target RouteRegistrar, path string, controller any, middlewares []Middleware) *Resource {
+	collection := make(map[string]http.HandlerFunc)
+	member := make(map[string]http.HandlerFunc)
+
+	action := func(name ResourceAction, handler http.HandlerFunc) http.HandlerFunc {
+		if m, ok := controller.(ActionMiddlewarer); ok {
+			return chainMiddlewares(handler, m.ActionMiddlewares(name))
+		}
+		return handler
+	}
+
+	if c, ok := controller.(Indexer); ok {
+		collection[http.MethodGet] = action(ActionIndex, c.Index)
+	}
+	if c, ok := controller.(Creator); ok {
+		collection[http.MethodPost] = action(ActionCreate, c.Create)
+	}
+	if c, ok := controller.(Shower); ok {
+		member[http.MethodGet] = action(ActionShow, c.Show)
+	}
+	if c, ok := controller.(Updater); ok {
+		update := action(ActionUpdate, c.Update)
+		member[http.MethodPut] = update
+		member[http.MethodPatch] = update
+	}
+	if c, ok := controller.(Deleter); ok {
+		member[http.MethodDelete] = action(ActionDelete, c.Delete)
+	}
+
+	if len(collection) == 0 && len(member) == 0 {
+		panic("resource controller for " + path + " implements no actions")
+	}
+
+	res := &Resource{}
+	if len(collection) > 0 {
+		res.Collection = newRouteWithHandlers(target, path, collection, middlewares)
+	}
+	if len(member) > 0 {
+		res.Member = newRouteWithHandlers(target, path+"/{"+ResourceIDParam+"}", member, middlewares)
+	}
+	return res
+}
+
+func newRouteWithHandlers(target RouteRegistrar, path string, handlers map[string]http.HandlerFunc, middlewares []Middleware) *Route {
+	mws := make([]Middleware, len(middlewares))
+	copy(mws, middlewares)
+
+	route := target.NewRoute(path, mws...)
+	for method, handler := range handlers {
+		route.Handle(method, handler)
+	}
+	return route
+}
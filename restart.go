@@ -0,0 +1,145 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// envListenAddrs passes the addresses of the listeners handed over by Restart to the new process.
+// Their file descriptors start at 3, in the same order.
+const envListenAddrs = "LIGHTMUX_LISTEN_ADDRS"
+
+// restarter tracks the open listeners handed over on graceful restart.
+type restarter struct {
+	mu        sync.Mutex
+	listeners []openListener
+	stop      chan struct{}
+}
+
+type openListener struct {
+	addr string
+	ln   net.Listener
+}
+
+func (r *restarter) track(addr string, ln net.Listener) {
+	r.mu.Lock()
+	r.listeners = append(r.listeners, openListener{addr: addr, ln: ln})
+	r.mu.Unlock()
+}
+
+// inherited holds the listener files handed over by the parent process, by address.
+var inherited struct {
+	once  sync.Once
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// inheritedListener returns the listener for addr handed over by the parent process, nil if there is none.
+func inheritedListener(addr string) (net.Listener, error) {
+	inherited.once.Do(func() {
+		inherited.files = make(map[string]*os.File)
+		addrs := os.Getenv(envListenAddrs)
+		if addrs == "" {
+			return
+		}
+		os.Unsetenv(envListenAddrs)
+		for i, addr := range strings.Split(addrs, ",") {
+			inherited.files[addr] = os.NewFile(uintptr(3+i), addr)
+		}
+	})
+
+	inherited.mu.Lock()
+	f, ok := inherited.files[addr]
+	delete(inherited.files, addr)
+	inherited.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("lightmux: inherited listener %q: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// EnableGracefulRestart makes the server call Restart when the process receives SIGUSR2 while Run is active.
+// Signals are only supported on Unix systems.
+func (l *LightMux) EnableGracefulRestart() {
+	l.onStart(l.watchRestartSignal)
+	l.onStop(l.stopRestartSignal)
+}
+
+// Restart starts a new process of the running binary with the same arguments and environment and hands
+// over all listeners, then gracefully shuts this server down: the new process accepts connections while
+// this one drains, and Run returns nil once drained. The new process must configure the same listen addresses,
+// which then reuse the handed over sockets instead of binding new ones.
+func (l *LightMux) Restart() error {
+	l.restart.mu.Lock()
+	listeners := slices.Clone(l.restart.listeners)
+	l.restart.mu.Unlock()
+	if len(listeners) == 0 {
+		return errors.New("lightmux: no listeners to hand over, the server is not running")
+	}
+
+	files := make([]*os.File, 0, len(listeners))
+	addrs := make([]string, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, open := range listeners {
+		filer, ok := open.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("lightmux: listener %q cannot be handed over", open.addr)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return fmt.Errorf("lightmux: listener %q: %w", open.addr, err)
+		}
+		files = append(files, f)
+		addrs = append(addrs, open.addr)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("lightmux: restart: %w", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envListenAddrs+"="+strings.Join(addrs, ","))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("lightmux: restart: %w", err)
+	}
+	l.logger.Info("Started new process, draining...", "pid", cmd.Process.Pid)
+	cmd.Process.Release()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+		defer cancel()
+		if err := l.Shutdown(ctx); err != nil {
+			l.logger.Error("shutdown after restart", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (l *LightMux) stopRestartSignal(context.Context) error {
+	l.restart.mu.Lock()
+	defer l.restart.mu.Unlock()
+	if l.restart.stop != nil {
+		close(l.restart.stop)
+		l.restart.stop = nil
+	}
+	return nil
+}
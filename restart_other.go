@@ -0,0 +1,7 @@
+//go:build !unix
+
+package lightmux
+
+func (l *LightMux) watchRestartSignal() {
+	l.logger.Error("graceful restart on SIGUSR2 is not supported on this platform, call Restart instead")
+}
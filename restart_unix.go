@@ -0,0 +1,34 @@
+//go:build unix
+
+package lightmux
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func (l *LightMux) watchRestartSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR2)
+
+	stop := make(chan struct{})
+	l.restart.mu.Lock()
+	l.restart.stop = stop
+	l.restart.mu.Unlock()
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-sigCh:
+				l.logger.Info("SIGUSR2 received, restarting...")
+				if err := l.Restart(); err != nil {
+					l.logger.Error("restart failed", "error", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
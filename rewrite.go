@@ -0,0 +1,98 @@
+package lightmux
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type originalPathCtxKey struct{}
+
+// RewriteRule rewrites a request path, ok is false when the rule does not apply.
+type RewriteRule func(r *http.Request, path string) (rewritten string, ok bool)
+
+// Rewrite returns a middleware rewriting the request path with rules, applied in order, each one
+// seeing the result of the previous ones. Register it with LightMux.Use so it runs before route matching.
+// The original path is available through OriginalPath.
+func Rewrite(rules ...RewriteRule) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			path, changed := r.URL.Path, false
+			for _, rule := range rules {
+				if rewritten, ok := rule(r, path); ok {
+					path, changed = rewritten, true
+				}
+			}
+			if !changed || path == r.URL.Path {
+				next(w, r)
+				return
+			}
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path, u.RawPath = path, ""
+			r2.URL = &u
+			next(w, r2.WithContext(context.WithValue(r.Context(), originalPathCtxKey{}, r.URL.Path)))
+		}
+	}
+}
+
+// OriginalPath returns the request path before Rewrite changed it.
+func OriginalPath(r *http.Request) string {
+	if path, ok := r.Context().Value(originalPathCtxKey{}).(string); ok {
+		return path
+	}
+	return r.URL.Path
+}
+
+// StripPrefix removes prefix from paths starting with it, e.g. a legacy "/v1" or an ingress mount point.
+// Only whole path segments are stripped: "/v1" matches "/v1" and "/v1/users" but not "/v10" or "/v1beta".
+func StripPrefix(prefix string) RewriteRule {
+	return func(_ *http.Request, path string) (string, bool) {
+		rest, ok := strings.CutPrefix(path, prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasSuffix(prefix, "/")) {
+			return "", false
+		}
+		return rest, true
+	}
+}
+
+// RegexRewrite replaces paths matching pattern with replacement, which may reference groups like $1 or ${name}.
+// It panics on an invalid pattern.
+func RegexRewrite(pattern, replacement string) RewriteRule {
+	re := regexp.MustCompile(pattern)
+	return func(_ *http.Request, path string) (string, bool) {
+		if !re.MatchString(path) {
+			return "", false
+		}
+		return re.ReplaceAllString(path, replacement), true
+	}
+}
+
+// StripHeaderPrefix removes the prefix sent by a proxy in header (e.g. X-Forwarded-Prefix) from the path.
+// Only use it behind proxies that set or strip the header, clients can send it too.
+func StripHeaderPrefix(header string) RewriteRule {
+	return func(r *http.Request, path string) (string, bool) {
+		prefix := strings.TrimSuffix(r.Header.Get(header), "/")
+		if prefix == "" {
+			return "", false
+		}
+		return StripPrefix(prefix)(r, path)
+	}
+}
+
+// WhenHeader applies rule only to requests whose header equals value, or carries the header at all if value is empty.
+func WhenHeader(header, value string, rule RewriteRule) RewriteRule {
+	return func(r *http.Request, path string) (string, bool) {
+		got, present := r.Header[http.CanonicalHeaderKey(header)]
+		if !present || (value != "" && (len(got) == 0 || got[0] != value)) {
+			return "", false
+		}
+		return rule(r, path)
+	}
+}
@@ -10,22 +10,67 @@ type Middleware func(http.HandlerFunc) http.HandlerFunc
 
 // Route represents an HTTP route with its path, supported methods, and middlewares.
 type Route struct {
-	Path        	string
-	Methods     	map[string]http.Handler
-	Middlewares 	[]Middleware
+	Path        string
+	Methods     map[string]http.Handler
+	Middlewares []Middleware
+
+	// Version is the API version the route was registered in (see VersionGroup), empty if unversioned.
+	Version string
+
+	// Metadata holds arbitrary values attached to the route (e.g. by a RouteTemplate).
+	Metadata map[string]any
+
+	// methodNotAllowed overrides the default 405 response, nil uses the default JSON error.
+	methodNotAllowed http.HandlerFunc
+
+	// middlewareNames holds the names of Middlewares by index, empty for unnamed ones (see RouteGroup.UseNamed).
+	middlewareNames []string
+
+	// skip holds the names of inherited middlewares the route opts out of.
+	skip map[string]bool
+
+	// encodings lists accepted request Content-Encodings, empty accepts all (see AcceptEncodings).
+	encodings []string
+
+	// inherited is the number of leading Middlewares that come from the group at groupPrefix.
+	inherited   int
+	groupPrefix string
+
+	// cors tunes CORS preflight responses of the route, see CORS.
+	cors *RouteCORS
+
+	// replaceDuplicates lets Handle replace handlers of registered methods, see SetDuplicateRoutes.
+	replaceDuplicates bool
+	// replaced are the methods whose handler was replaced, logged by ApplyRoutes.
+	replaced []string
+
+	// admin marks built-in operational endpoints, guarded is set once the admin guard was attached (see SetAdminGuard).
+	admin   bool
+	guarded bool
 }
 
 // NewRoute creates a new Route with the given path and optional middlewares.
 func (l *LightMux) NewRoute(path string, middlewares ...Middleware) *Route {
 	// Check for duplicate path
-	if _, exists := l.routeMap[path]; exists {
-		panic(fmt.Sprintf("route with path %v already exists", path))
+	if existing, exists := l.routeMap[path]; exists {
+		if l.duplicates != ReplaceDuplicates {
+			panic(fmt.Sprintf("route with path %v already exists", path))
+		}
+		l.logger.Info("Route registered again, replaced its middlewares", "path", path)
+		existing.Middlewares = middlewares
+		existing.middlewareNames = make([]string, len(middlewares))
+		existing.inherited = 0
+		return existing
 	}
 
 	r := &Route{
-		Path:        path,
-		Methods:     make(map[string]http.Handler),
-		Middlewares: middlewares,
+		Path:            path,
+		Methods:         make(map[string]http.Handler),
+		Middlewares:     middlewares,
+		Metadata:        make(map[string]any),
+		middlewareNames: make([]string, len(middlewares)),
+
+		replaceDuplicates: l.duplicates == ReplaceDuplicates,
 	}
 
 	l.routeMap[path] = r
@@ -34,12 +79,30 @@ func (l *LightMux) NewRoute(path string, middlewares ...Middleware) *Route {
 }
 
 // Use adds middlewares into route middlewares.
-func (r *Route) Use(middlewares ...Middleware)  {
+func (r *Route) Use(middlewares ...Middleware) {
 	r.Middlewares = append(r.Middlewares, middlewares...)
+	r.middlewareNames = append(r.middlewareNames, make([]string, len(middlewares))...)
+}
+
+// Skip opts the route out of named middlewares (see LightMux.UseNamed and RouteGroup.UseNamed),
+// e.g. a public status endpoint living under an otherwise authenticated group.
+func (r *Route) Skip(names ...string) {
+	if r.skip == nil {
+		r.skip = make(map[string]bool)
+	}
+	for _, name := range names {
+		r.skip[name] = true
+	}
+}
+
+// MethodNotAllowed overrides the 405 response written when the route is requested with an unregistered method.
+// The Allow header is already set when the handler is called.
+func (r *Route) MethodNotAllowed(handler http.HandlerFunc) {
+	r.methodNotAllowed = handler
 }
 
 // Handle registers a handler for a specific HTTP method on the route.
-// Middlewares are not wrapped here; they are applied when serving the request.
+// Middlewares are not wrapped here; they are applied by ApplyRoutes, so Use and Skip may be called in any order.
 func (r *Route) Handle(method string, handler http.HandlerFunc) {
 	if !isValidMethod(method) {
 		panic("invalid HTTP method: " + method)
@@ -47,16 +110,71 @@ func (r *Route) Handle(method string, handler http.HandlerFunc) {
 
 	// check if method already exists
 	if _, exists := r.Methods[method]; exists {
-		panic("duplicate method for path: " + method + " " + r.Path)
+		if !r.replaceDuplicates {
+			panic("duplicate method for path: " + method + " " + r.Path)
+		}
+		r.replaced = append(r.replaced, method)
+	}
+
+	r.Methods[method] = handler
+}
+
+// buildHandlers wraps the route handlers with the route middlewares and the named global middlewares
+// and returns them by method, along with the value of the Allow header.
+// Routes without an explicit OPTIONS handler answer OPTIONS automatically through
+// their middlewares, so e.g. a group CORS middleware can handle preflight requests.
+// The automatic response includes the Allow header only when exposeAllow is set.
+func (r *Route) buildHandlers(exposeAllow bool, named []namedMiddleware) (map[string]http.Handler, string) {
+	handlers := make(map[string]http.Handler, len(r.Methods)+1)
+	for method, handler := range r.Methods {
+		handlers[method] = r.wrapMiddlewares(handler.ServeHTTP, named)
+	}
+
+	if _, ok := handlers[http.MethodOptions]; ok {
+		return handlers, allowedMethodsJoin(handlers)
 	}
 
-	r.Methods[method] = r.wrapMiddlewares(handler)
+	handlers[http.MethodOptions] = nil
+	allowed := allowedMethodsJoin(handlers)
+	handlers[http.MethodOptions] = r.wrapMiddlewares(func(w http.ResponseWriter, req *http.Request) {
+		if exposeAllow {
+			w.Header().Set("Allow", allowed)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}, named)
+	return handlers, allowed
 }
 
-// wrapMiddlewares applies the route's middlewares to the given handler.
-func (r *Route) wrapMiddlewares(handler http.HandlerFunc) http.HandlerFunc {
+// chainLength returns the number of route and named global middlewares wrapping the route handlers.
+func (r *Route) chainLength(named []namedMiddleware) int {
+	n := 0
+	for i := range r.Middlewares {
+		if i >= len(r.middlewareNames) || r.middlewareNames[i] == "" || !r.skip[r.middlewareNames[i]] {
+			n++
+		}
+	}
+	for _, m := range named {
+		if !r.skip[m.name] {
+			n++
+		}
+	}
+	return n
+}
+
+// wrapMiddlewares applies the route's middlewares and then the named global middlewares to the given handler,
+// leaving out skipped ones.
+func (r *Route) wrapMiddlewares(handler http.HandlerFunc, named []namedMiddleware) http.HandlerFunc {
 	for i := len(r.Middlewares) - 1; i >= 0; i-- {
+		if i < len(r.middlewareNames) && r.middlewareNames[i] != "" && r.skip[r.middlewareNames[i]] {
+			continue
+		}
 		handler = r.Middlewares[i](handler)
 	}
+	for i := len(named) - 1; i >= 0; i-- {
+		if r.skip[named[i].name] {
+			continue
+		}
+		handler = named[i].middleware(handler)
+	}
 	return handler
-}
\ No newline at end of file
+}
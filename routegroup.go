@@ -1,10 +1,24 @@
 package lightmux
 
+import "net/http"
+
 // RouteGroup represents a group of routes with a common prefix and shared middlewares.
 type RouteGroup struct {
 	prefix      string
 	middlewares []Middleware
 	mux         *LightMux
+
+	// names holds the names of middlewares by index, empty for unnamed ones.
+	names []string
+
+	// version is the API version routes of the group belong to, empty if unversioned.
+	version string
+
+	// methodNotAllowed overrides the 405 response of routes created in the group.
+	methodNotAllowed http.HandlerFunc
+
+	// encodings lists accepted request Content-Encodings of routes created in the group.
+	encodings []string
 }
 
 // NewGroup creates a new RouteGroup with the given prefix and optional middlewares.
@@ -13,30 +27,69 @@ func (l *LightMux) NewGroup(prefix string, middlewares ...Middleware) *RouteGrou
 		prefix:      prefix,
 		middlewares: middlewares,
 		mux:         l,
+		names:       make([]string, len(middlewares)),
 	}
 }
 
+// Use adds middlewares to the group, applied to routes created in the group afterwards.
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+	g.names = append(g.names, make([]string, len(middlewares))...)
+}
+
+// UseNamed adds a named middleware to the group. Routes created in the group (or in groups continued from it)
+// can opt out of it with Route.Skip(name).
+func (g *RouteGroup) UseNamed(name string, middleware Middleware) {
+	g.middlewares = append(g.middlewares, middleware)
+	g.names = append(g.names, name)
+}
+
 // NewRoute creates a new Route within the RouteGroup with the given path and optional middlewares.
 func (g *RouteGroup) NewRoute(path string, middlewares ...Middleware) *Route {
 	fullPath := g.prefix + path
-	allMiddleware := append(g.middlewares, middlewares...)
-	return g.mux.NewRoute(fullPath, allMiddleware...)
+
+	allMiddleware := make([]Middleware, 0, len(g.middlewares)+len(middlewares))
+	allMiddleware = append(allMiddleware, g.middlewares...)
+	allMiddleware = append(allMiddleware, middlewares...)
+
+	route := g.mux.NewRoute(fullPath, allMiddleware...)
+	copy(route.middlewareNames, g.names)
+	route.inherited, route.groupPrefix = len(g.middlewares), g.prefix
+	route.Version = g.version
+	route.methodNotAllowed = g.methodNotAllowed
+	route.encodings = g.encodings
+	return route
+}
+
+// MethodNotAllowed overrides the 405 response (body, content type, headers) of routes created in the group
+// afterwards, including routes of groups continued from it. The Allow header is already set when the handler is called.
+func (g *RouteGroup) MethodNotAllowed(handler http.HandlerFunc) {
+	g.methodNotAllowed = handler
 }
 
-// 
+// ContinueGroup creates a nested RouteGroup whose prefix and middlewares extend the ones of g.
 func (g *RouteGroup) ContinueGroup(path string, middlewares ...Middleware) *RouteGroup {
 	newPrefix := g.prefix + path
-	
+
 	newMiddlewares := make([]Middleware, len(g.middlewares))
 	copy(newMiddlewares, g.middlewares)
 
 	newMiddlewares = append(newMiddlewares, middlewares...)
 
+	newNames := make([]string, len(g.names), len(newMiddlewares))
+	copy(newNames, g.names)
+	newNames = append(newNames, make([]string, len(middlewares))...)
+
 	newGroup := &RouteGroup{
-		prefix: newPrefix,
+		prefix:      newPrefix,
 		middlewares: newMiddlewares,
-		mux: g.mux,
+		mux:         g.mux,
+		names:       newNames,
+		version:     g.version,
+
+		methodNotAllowed: g.methodNotAllowed,
+		encodings:        g.encodings,
 	}
 
 	return newGroup
-}
\ No newline at end of file
+}
@@ -0,0 +1,195 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Component is a long-lived part of an application supervised by a Runner.
+type Component interface {
+	// Start runs the component and blocks until it stops or ctx is cancelled.
+	// Returning early, with or without error, shuts down the whole Runner.
+	Start(ctx context.Context) error
+	// Stop gracefully stops the component within ctx. It is called even if Start already returned.
+	Stop(ctx context.Context) error
+}
+
+// FuncComponent adapts functions to the Component interface, nil functions are no-ops.
+// A nil StartFunc blocks until the Runner shuts down.
+type FuncComponent struct {
+	StartFunc func(ctx context.Context) error
+	StopFunc  func(ctx context.Context) error
+}
+
+// Start implements Component.
+func (c FuncComponent) Start(ctx context.Context) error {
+	if c.StartFunc == nil {
+		<-ctx.Done()
+		return nil
+	}
+	return c.StartFunc(ctx)
+}
+
+// Stop implements Component.
+func (c FuncComponent) Stop(ctx context.Context) error {
+	if c.StopFunc == nil {
+		return nil
+	}
+	return c.StopFunc(ctx)
+}
+
+// Component returns l as a Component: Start runs the server (see Run) and Stop shuts it down gracefully,
+// so the HTTP server can share one lifecycle with other components of a Runner.
+func (l *LightMux) Component() Component {
+	return FuncComponent{
+		StartFunc: l.Run,
+		StopFunc:  l.Shutdown,
+	}
+}
+
+// RunServers runs several servers (e.g. public API on :8080, admin on :9090, metrics on :9100) with one call:
+// they start together and all stop on SIGINT/SIGTERM, ctx cancellation or the failure of one of them,
+// draining within the longest shutdown timeout. It is a shorthand for a Runner with one component per server.
+func RunServers(ctx context.Context, servers ...*LightMux) error {
+	runner := NewRunner()
+	for i, l := range servers {
+		name := l.server.Addr
+		if name == "" {
+			name = fmt.Sprintf("server %d", i+1)
+		}
+		runner.ShutdownTimeout = max(runner.ShutdownTimeout, l.shutdownTimeout)
+		runner.Add(name, l.Component())
+	}
+	if len(servers) > 0 {
+		runner.Logger = servers[0].logger
+	}
+	return runner.Run(ctx)
+}
+
+// Runner supervises components sharing one lifecycle: it starts all of them, waits for a shutdown signal,
+// context cancellation or a component returning, then stops them in reverse order.
+type Runner struct {
+	// Signals triggering shutdown, NewRunner sets os.Interrupt and SIGTERM.
+	// Leave it empty (or call WithoutSignals) when the lifecycle is managed elsewhere, e.g. by a Windows service
+	// or an orchestrator; Run then stops only on ctx cancellation or a component returning.
+	Signals []os.Signal
+	// ShutdownTimeout bounds stopping all components, default: 5 seconds.
+	ShutdownTimeout time.Duration
+	// Logger receives lifecycle messages, default: the standard logger.
+	Logger Logger
+
+	components []runnerComponent
+}
+
+type runnerComponent struct {
+	name      string
+	component Component
+}
+
+type runnerResult struct {
+	name string
+	err  error
+}
+
+// NewRunner creates a Runner with default signals and shutdown timeout.
+func NewRunner() *Runner {
+	return &Runner{
+		Signals:         []os.Signal{os.Interrupt, syscall.SIGTERM},
+		ShutdownTimeout: 5 * time.Second,
+	}
+}
+
+// WithSignals replaces the signals triggering shutdown, e.g. WithSignals(syscall.SIGINT, syscall.SIGHUP).
+// Calling it without signals disables signal handling.
+func (r *Runner) WithSignals(signals ...os.Signal) *Runner {
+	r.Signals = signals
+	return r
+}
+
+// WithoutSignals disables signal handling, see WithSignals.
+func (r *Runner) WithoutSignals() *Runner {
+	return r.WithSignals()
+}
+
+// Add registers a component, name is used in logs and errors.
+func (r *Runner) Add(name string, c Component) {
+	r.components = append(r.components, runnerComponent{name: name, component: c})
+}
+
+// Run starts all components and blocks until they are stopped. It returns the joined errors of
+// components that failed to run or stop; a shutdown triggered by a signal or ctx is not an error.
+func (r *Runner) Run(ctx context.Context) error {
+	if len(r.components) == 0 {
+		return nil
+	}
+
+	if len(r.Signals) > 0 {
+		var stopSignals context.CancelFunc
+		ctx, stopSignals = signal.NotifyContext(ctx, r.Signals...)
+		defer stopSignals()
+	}
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+
+	done := make(chan runnerResult, len(r.components))
+	for _, c := range r.components {
+		go func() {
+			done <- runnerResult{name: c.name, err: c.component.Start(runCtx)}
+		}()
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = StdLogger(log.Default())
+	}
+
+	var errs []error
+	running := len(r.components)
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown requested, stopping components...")
+	case res := <-done:
+		running--
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.name, res.err))
+		}
+		logger.Info("Component stopped, stopping remaining components...", "component", res.name)
+	}
+
+	timeout := r.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), timeout)
+	defer cancelStop()
+
+	for i := len(r.components) - 1; i >= 0; i-- {
+		c := r.components[i]
+		if err := c.component.Stop(stopCtx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: stop: %w", c.name, err))
+		}
+	}
+	cancelRun()
+
+	for ; running > 0; running-- {
+		select {
+		case res := <-done:
+			if res.err != nil && !errors.Is(res.err, context.Canceled) {
+				errs = append(errs, fmt.Errorf("%s: %w", res.name, res.err))
+			}
+		case <-stopCtx.Done():
+			return errors.Join(append(errs, fmt.Errorf("%d components did not stop within %s", running, timeout))...)
+		}
+	}
+
+	logger.Info("All components stopped.")
+	return errors.Join(errs...)
+}
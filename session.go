@@ -0,0 +1,245 @@
+package lightmux
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type sessionCtxKey struct{}
+
+// SessionStore persists session values by session ID.
+type SessionStore interface {
+	// Load returns the values of the session, ok is false if it does not exist or expired.
+	Load(ctx context.Context, id string) (values map[string]any, ok bool, err error)
+	// Save stores the values of the session for ttl.
+	Save(ctx context.Context, id string, values map[string]any, ttl time.Duration) error
+	// Delete removes the session.
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionConfig configures the Sessions middleware.
+type SessionConfig struct {
+	// Store keeps the sessions, default: a new MemorySessionStore.
+	Store SessionStore
+	// CookieName of the session ID cookie, default: "lightmux_session".
+	CookieName string
+	// TTL of sessions and their cookie, refreshed on every Save. Default: 24 hours.
+	TTL time.Duration
+	// Cookie attributes, the cookie is always HttpOnly. SameSite defaults to Lax.
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	// Logger receives store errors, default: the Logger of the LightMux (see WithLogger).
+	Logger Logger
+}
+
+// SessionData is the session of a request, see Session.
+// Changes are persisted by Save, which must be called before the response is written
+// since it may set the session cookie.
+type SessionData struct {
+	mu     sync.Mutex
+	id     string
+	values map[string]any
+	isNew  bool
+	cfg    *SessionConfig
+	w      http.ResponseWriter
+	ctx    context.Context
+}
+
+// Sessions returns a middleware loading the session identified by the session cookie, available through Session.
+// Unknown or expired session IDs are never reused, a fresh ID is generated instead.
+func Sessions(cfg SessionConfig) Middleware {
+	if cfg.Store == nil {
+		cfg.Store = NewMemorySessionStore()
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "lightmux_session"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == 0 {
+		cfg.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			s := &SessionData{cfg: &cfg, w: w, ctx: r.Context()}
+
+			if cookie, err := r.Cookie(cfg.CookieName); err == nil && validRequestID(cookie.Value) {
+				values, ok, err := cfg.Store.Load(r.Context(), cookie.Value)
+				if err != nil {
+					loggerOr(cfg.Logger, r).Error("session store", "error", err)
+				}
+				if ok {
+					s.id, s.values = cookie.Value, values
+				}
+			}
+			if s.id == "" {
+				s.id, s.values, s.isNew = newID(), make(map[string]any), true
+			}
+
+			next(w, r.WithContext(context.WithValue(r.Context(), sessionCtxKey{}, s)))
+		}
+	}
+}
+
+// Session returns the session of the request, or nil if the Sessions middleware was not applied.
+func Session(r *http.Request) *SessionData {
+	s, _ := r.Context().Value(sessionCtxKey{}).(*SessionData)
+	return s
+}
+
+// ID returns the session ID.
+func (s *SessionData) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Get returns the value stored under key, or nil.
+func (s *SessionData) Get(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set stores value under key.
+func (s *SessionData) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Delete removes the value stored under key.
+func (s *SessionData) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// Save persists the session values and (re)sets the session cookie.
+func (s *SessionData) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.cfg.Store.Save(s.ctx, s.id, maps.Clone(s.values), s.cfg.TTL); err != nil {
+		return err
+	}
+	s.isNew = false
+	s.setCookie(s.id, int(s.cfg.TTL/time.Second))
+	return nil
+}
+
+// RenewID moves the session to a new ID, to be called on privilege changes such as login
+// to prevent session fixation. The session is saved under the new ID.
+func (s *SessionData) RenewID() error {
+	s.mu.Lock()
+	oldID, isNew := s.id, s.isNew
+	s.id = newID()
+	s.mu.Unlock()
+
+	if !isNew {
+		if err := s.cfg.Store.Delete(s.ctx, oldID); err != nil {
+			return err
+		}
+	}
+	return s.Save()
+}
+
+// Destroy deletes the session from the store and expires the session cookie.
+func (s *SessionData) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.cfg.Store.Delete(s.ctx, s.id); err != nil {
+		return err
+	}
+	s.id, s.values, s.isNew = newID(), make(map[string]any), true
+	s.setCookie("", -1)
+	return nil
+}
+
+func (s *SessionData) setCookie(value string, maxAge int) {
+	http.SetCookie(s.w, &http.Cookie{
+		Name:     s.cfg.CookieName,
+		Value:    value,
+		Path:     s.cfg.Path,
+		Domain:   s.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.Secure,
+		HttpOnly: true,
+		SameSite: s.cfg.SameSite,
+	})
+}
+
+// MemorySessionStore is an in-process SessionStore, sessions are lost on restart.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	values  map[string]any
+	expires time.Time
+}
+
+// NewMemorySessionStore creates a MemorySessionStore. Expired sessions are removed periodically on Save.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:  make(map[string]memorySession),
+		lastSweep: time.Now(),
+	}
+}
+
+// Load implements SessionStore.
+func (s *MemorySessionStore) Load(_ context.Context, id string) (map[string]any, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return nil, false, nil
+	}
+	return maps.Clone(session.values), true, nil
+}
+
+// Save implements SessionStore.
+func (s *MemorySessionStore) Save(_ context.Context, id string, values map[string]any, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for key, session := range s.sessions {
+			if now.After(session.expires) {
+				delete(s.sessions, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.sessions[id] = memorySession{values: values, expires: now.Add(ttl)}
+	return nil
+}
+
+// Delete implements SessionStore.
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
@@ -0,0 +1,151 @@
+package lightmux
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLOMetadataKey is the route Metadata key holding the SLO of a route, see Route.SetSLO.
+const SLOMetadataKey = "slo"
+
+// sloBuckets is the number of buckets of the rolling SLO window.
+const sloBuckets = 60
+
+// SLO is a latency and error objective of a route. A request is bad if it fails with a 5xx status
+// or, when Latency is set, takes longer than Latency.
+type SLO struct {
+	// Latency is the latency target, zero only counts errors.
+	Latency time.Duration
+	// Objective is the fraction of good requests to reach, e.g. 0.99. Default: 0.99.
+	Objective float64
+	// Window of the rolling compliance, default: 1 hour.
+	Window time.Duration
+	// BurnRate triggering the burn hooks: the error budget is consumed BurnRate times faster
+	// than the objective allows. Default: 2.
+	BurnRate float64
+	// MinRequests in the window before burn hooks fire, avoiding alerts on sparse traffic. Default: 20.
+	MinRequests int64
+}
+
+// SLOStatus is the rolling compliance of a route SLO.
+type SLOStatus struct {
+	Route string
+	SLO   SLO
+	// Total and Bad are the requests in the window.
+	Total int64
+	Bad   int64
+	// Compliance is the fraction of good requests, 1 without traffic.
+	Compliance float64
+	// BurnRate is how many times faster than allowed the error budget is consumed.
+	BurnRate float64
+}
+
+// SetSLO declares the latency/error objective of the route, stored in its Metadata under SLOMetadataKey.
+// Compliance is tracked once routes are applied, see LightMux.SLOStatus and LightMux.OnSLOBurn.
+func (r *Route) SetSLO(slo SLO) {
+	r.Metadata[SLOMetadataKey] = slo
+}
+
+// OnSLOBurn registers a hook called when a route starts burning its error budget faster than its SLO.BurnRate.
+// It is called once per burn episode, again only after the burn rate dropped below the threshold.
+// Hooks run on the request goroutine that crossed the threshold.
+func (l *LightMux) OnSLOBurn(hook func(status SLOStatus)) {
+	l.sloHooks = append(l.sloHooks, hook)
+}
+
+// SLOStatus returns the rolling compliance of all routes with an SLO, sorted by route.
+func (l *LightMux) SLOStatus() []SLOStatus {
+	statuses := make([]SLOStatus, 0, len(l.sloTrackers))
+	for _, t := range l.sloTrackers {
+		t.mu.Lock()
+		statuses = append(statuses, t.status(time.Now()))
+		t.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+	return statuses
+}
+
+type sloBucket struct {
+	epoch      int64
+	total, bad int64
+}
+
+// sloTracker keeps the rolling window of a route SLO in a ring of buckets.
+type sloTracker struct {
+	mu      sync.Mutex
+	route   string
+	slo     SLO
+	width   time.Duration
+	buckets [sloBuckets]sloBucket
+	burning bool
+	mux     *LightMux
+}
+
+func (l *LightMux) newSLOTracker(route string, slo SLO) *sloTracker {
+	if slo.Objective <= 0 || slo.Objective >= 1 {
+		slo.Objective = 0.99
+	}
+	if slo.Window <= 0 {
+		slo.Window = time.Hour
+	}
+	if slo.BurnRate <= 0 {
+		slo.BurnRate = 2
+	}
+	if slo.MinRequests <= 0 {
+		slo.MinRequests = 20
+	}
+
+	t := &sloTracker{route: route, slo: slo, width: slo.Window / sloBuckets, mux: l}
+	if t.width <= 0 {
+		t.width = 1
+	}
+	l.sloTrackers = append(l.sloTrackers, t)
+	return t
+}
+
+func (t *sloTracker) observe(m RequestMetric) {
+	bad := m.Status >= 500 || (t.slo.Latency > 0 && m.Duration > t.slo.Latency)
+	now := time.Now()
+
+	t.mu.Lock()
+	epoch := now.UnixNano() / int64(t.width)
+	b := &t.buckets[epoch%sloBuckets]
+	if b.epoch != epoch {
+		*b = sloBucket{epoch: epoch}
+	}
+	b.total++
+	if bad {
+		b.bad++
+	}
+
+	st := t.status(now)
+	burning := st.Total >= t.slo.MinRequests && st.BurnRate > t.slo.BurnRate
+	fire := burning && !t.burning
+	t.burning = burning
+	t.mu.Unlock()
+
+	if fire {
+		for _, hook := range t.mux.sloHooks {
+			hook(st)
+		}
+	}
+}
+
+// status sums the buckets of the window ending at now, t.mu must be held.
+func (t *sloTracker) status(now time.Time) SLOStatus {
+	st := SLOStatus{Route: t.route, SLO: t.slo, Compliance: 1}
+	current := now.UnixNano() / int64(t.width)
+	for _, b := range t.buckets {
+		if b.epoch > current-sloBuckets && b.epoch <= current {
+			st.Total += b.total
+			st.Bad += b.bad
+		}
+	}
+	if st.Total > 0 {
+		errorRate := float64(st.Bad) / float64(st.Total)
+		st.Compliance = 1 - errorRate
+		st.BurnRate = errorRate / (1 - t.slo.Objective)
+	}
+	return st
+}
@@ -0,0 +1,56 @@
+package lightmux
+
+import (
+	"net/http"
+	"slices"
+)
+
+// MiddlewareStack is an immutable, reusable list of middlewares that can be composed and applied
+// to several groups and routes. Append and Clone always return new stacks, so stacks derived from
+// a shared base never overwrite each other's middlewares.
+type MiddlewareStack struct {
+	middlewares []Middleware
+}
+
+// NewStack creates a MiddlewareStack applying middlewares in the given order.
+func NewStack(middlewares ...Middleware) MiddlewareStack {
+	return MiddlewareStack{middlewares: slices.Clone(middlewares)}
+}
+
+// Append returns a new stack with middlewares added after the ones of s.
+func (s MiddlewareStack) Append(middlewares ...Middleware) MiddlewareStack {
+	return MiddlewareStack{middlewares: slices.Concat(s.middlewares, middlewares)}
+}
+
+// Extend returns a new stack with the middlewares of other added after the ones of s.
+func (s MiddlewareStack) Extend(other MiddlewareStack) MiddlewareStack {
+	return s.Append(other.middlewares...)
+}
+
+// Clone returns a copy of s.
+func (s MiddlewareStack) Clone() MiddlewareStack {
+	return NewStack(s.middlewares...)
+}
+
+// Len returns the number of middlewares in the stack.
+func (s MiddlewareStack) Len() int {
+	return len(s.middlewares)
+}
+
+// Middlewares returns a copy of the middlewares, e.g. for group.Use(stack.Middlewares()...).
+func (s MiddlewareStack) Middlewares() []Middleware {
+	return slices.Clone(s.middlewares)
+}
+
+// Middleware returns the whole stack as a single Middleware.
+func (s MiddlewareStack) Middleware() Middleware {
+	middlewares := s.Middlewares()
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return chainMiddlewares(next, middlewares)
+	}
+}
+
+// Then wraps handler with the stack.
+func (s MiddlewareStack) Then(handler http.HandlerFunc) http.HandlerFunc {
+	return chainMiddlewares(handler, s.middlewares)
+}
@@ -0,0 +1,185 @@
+package lightmux
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// RouteStats are the request counters of a route and method, see LightMux.Stats.
+type RouteStats struct {
+	Route  string
+	Method string
+	Total  int64
+	// Responses by status class.
+	Status1xx int64
+	Status2xx int64
+	Status3xx int64
+	Status4xx int64
+	Status5xx int64
+	// LastHit is when the route was last requested, zero if never.
+	LastHit time.Time
+}
+
+// ErrorRate returns the fraction of 5xx responses, 0 without traffic.
+func (s RouteStats) ErrorRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Status5xx) / float64(s.Total)
+}
+
+// methodCounters counts responses of a route method by status class (index 1 to 5).
+type methodCounters struct {
+	route   string
+	method  string
+	classes [6]atomic.Int64
+	lastHit atomic.Int64 // Unix nanoseconds
+}
+
+// EnableStats turns on per-route request counters, queryable with Stats. It must be called before Run.
+func (l *LightMux) EnableStats() {
+	l.statsEnabled = true
+}
+
+// Stats returns the request counters by route pattern and method, sorted by route and method.
+// Requests matching no route are not counted. It returns nil unless EnableStats was called.
+func (l *LightMux) Stats() []RouteStats {
+	if !l.statsEnabled {
+		return nil
+	}
+
+	stats := make([]RouteStats, 0, len(l.counters))
+	for _, c := range l.counters {
+		s := RouteStats{
+			Route:     c.route,
+			Method:    c.method,
+			Status1xx: c.classes[1].Load(),
+			Status2xx: c.classes[2].Load(),
+			Status3xx: c.classes[3].Load(),
+			Status4xx: c.classes[4].Load(),
+			Status5xx: c.classes[5].Load(),
+		}
+		if lastHit := c.lastHit.Load(); lastHit != 0 {
+			s.LastHit = time.Unix(0, lastHit)
+		}
+		s.Total = s.Status1xx + s.Status2xx + s.Status3xx + s.Status4xx + s.Status5xx
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Route != stats[j].Route {
+			return stats[i].Route < stats[j].Route
+		}
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// RouteStats returns the request counters by route pattern across all methods, sorted by route,
+// with Method left empty. Routes never requested have a zero Total and LastHit, which helps finding
+// dead routes before deleting them. It returns nil unless EnableStats was called.
+func (l *LightMux) RouteStats() []RouteStats {
+	var routes []RouteStats
+	for _, s := range l.Stats() {
+		if len(routes) == 0 || routes[len(routes)-1].Route != s.Route {
+			routes = append(routes, RouteStats{Route: s.Route})
+		}
+		r := &routes[len(routes)-1]
+		r.Total += s.Total
+		r.Status1xx += s.Status1xx
+		r.Status2xx += s.Status2xx
+		r.Status3xx += s.Status3xx
+		r.Status4xx += s.Status4xx
+		r.Status5xx += s.Status5xx
+		if s.LastHit.After(r.LastHit) {
+			r.LastHit = s.LastHit
+		}
+	}
+	return routes
+}
+
+// newCountersObserver creates the counters of the route methods and returns the observer updating them.
+func (l *LightMux) newCountersObserver(route string, handlers map[string]http.Handler) routeObserver {
+	byMethod := make(map[string]*methodCounters, len(handlers))
+	for method := range handlers {
+		c := &methodCounters{route: route, method: method}
+		byMethod[method] = c
+		l.counters = append(l.counters, c)
+	}
+
+	return func(m RequestMetric) {
+		c := byMethod[m.Method]
+		if class := m.Status / 100; class >= 1 && class <= 5 {
+			c.classes[class].Add(1)
+		}
+		c.lastHit.Store(time.Now().UnixNano())
+	}
+}
+
+// routeObserver receives the measurement of every request served by a route.
+type routeObserver func(m RequestMetric)
+
+// routeObservers returns the observers of the stats subsystem interested in route.
+func (l *LightMux) routeObservers(route *Route, handlers map[string]http.Handler) []routeObserver {
+	var observers []routeObserver
+	if l.statsEnabled {
+		observers = append(observers, l.newCountersObserver(route.Path, handlers))
+	}
+	if len(l.metricsSinks) > 0 {
+		observers = append(observers, l.sinkObserver())
+	}
+	for _, w := range l.errorWatchdogs {
+		if observe := w.newObserver(route.Path); observe != nil {
+			observers = append(observers, observe)
+		}
+	}
+	if slo, ok := route.Metadata[SLOMetadataKey].(SLO); ok {
+		observers = append(observers, l.newSLOTracker(route.Path, slo).observe)
+	}
+	return observers
+}
+
+// instrument wraps the route handlers so observers see the status, duration and body sizes of every request,
+// measured around the route middlewares.
+func instrument(route string, handlers map[string]http.Handler, observers []routeObserver) {
+	if len(observers) == 0 {
+		return
+	}
+	for method, handler := range handlers {
+		handlers[method] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			handler.ServeHTTP(rec, r)
+
+			m := RequestMetric{
+				Route:        route,
+				Method:       method,
+				Status:       rec.Status(),
+				Duration:     time.Since(start),
+				Bytes:        rec.bytes,
+				RequestBytes: max(body.n, r.ContentLength),
+			}
+			for _, observe := range observers {
+				observe(m)
+			}
+		})
+	}
+}
+
+// countingReader counts the request body bytes read by the handler.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,66 @@
+package lightmux
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// ServerStatus summarizes the running server for operational triage, see Status.
+type ServerStatus struct {
+	StartTime time.Time `json:"start_time"`
+	// Uptime is formatted like "1h2m3s".
+	Uptime     string      `json:"uptime"`
+	Goroutines int         `json:"goroutines"`
+	Memory     MemoryStats `json:"memory"`
+	// Connections reports the open connections, see ConnStats.
+	Connections ConnStats `json:"connections"`
+	InFlight    int       `json:"in_flight"`
+	Draining    bool      `json:"draining"`
+}
+
+// MemoryStats is a subset of runtime.MemStats, in bytes.
+type MemoryStats struct {
+	Alloc      uint64 `json:"alloc"`
+	TotalAlloc uint64 `json:"total_alloc"`
+	Sys        uint64 `json:"sys"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+// Status returns the uptime, goroutine count, memory stats, open connections and drain state of the server.
+// It reads runtime.MemStats, which briefly stops the world, so it should not be polled at high frequency.
+func (l *LightMux) Status() ServerStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	status := ServerStatus{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			Alloc:      mem.Alloc,
+			TotalAlloc: mem.TotalAlloc,
+			Sys:        mem.Sys,
+			HeapInuse:  mem.HeapInuse,
+			NumGC:      mem.NumGC,
+		},
+		Connections: l.ConnStats(),
+		InFlight:    len(l.InFlight()),
+		Draining:    l.Draining(),
+	}
+	if started := l.startedAt.Load(); started != 0 {
+		status.StartTime = time.Unix(0, started).UTC()
+		status.Uptime = time.Since(status.StartTime).Round(time.Second).String()
+	}
+	return status
+}
+
+// EnableStatusEndpoint serves Status as JSON on path (e.g. "/status"). The endpoint is protected
+// by the admin guard if set, middlewares (e.g. authentication) run after it. It must be called before Run.
+func (l *LightMux) EnableStatusEndpoint(path string, middlewares ...Middleware) {
+	l.adminRoute(path, middlewares...).Handle(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header()["Cache-Control"] = probeNoStore
+		json.NewEncoder(w).Encode(l.Status())
+	})
+}
@@ -0,0 +1,44 @@
+package lightmux
+
+import "net/http"
+
+// RouteRegistrar is implemented by everything routes can be created on, namely LightMux and RouteGroup.
+type RouteRegistrar interface {
+	NewRoute(path string, middlewares ...Middleware) *Route
+}
+
+// RouteTemplate describes a reusable route shape: a path pattern, middlewares and metadata defaults.
+// A template can be instantiated multiple times under different prefixes with different handlers,
+// which removes duplication when many resources share the same layout.
+type RouteTemplate struct {
+	Path        string
+	Middlewares []Middleware
+	Metadata    map[string]any
+}
+
+// NewRouteTemplate creates a new RouteTemplate with the given path pattern and optional middlewares.
+func NewRouteTemplate(path string, middlewares ...Middleware) *RouteTemplate {
+	return &RouteTemplate{
+		Path:        path,
+		Middlewares: middlewares,
+		Metadata:    make(map[string]any),
+	}
+}
+
+// WithMetadata sets a metadata default that is copied into every route created from the template.
+func (t *RouteTemplate) WithMetadata(key string, value any) *RouteTemplate {
+	t.Metadata[key] = value
+	return t
+}
+
+// Instantiate creates a route on target at prefix + template path.
+// Template middlewares are applied after the target's own middlewares (e.g. group middlewares),
+// metadata defaults are copied into the route, and handlers are registered by HTTP method.
+func (t *RouteTemplate) Instantiate(target RouteRegistrar, prefix string, handlers map[string]http.HandlerFunc) *Route {
+	route := newRouteWithHandlers(target, prefix+t.Path, handlers, t.Middlewares)
+	for key, value := range t.Metadata {
+		route.Metadata[key] = value
+	}
+
+	return route
+}
@@ -0,0 +1,116 @@
+package lightmux
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutConfig configures the Timeout middleware.
+type TimeoutConfig struct {
+	// Timeout after which the handler is cut off.
+	Timeout time.Duration
+	// OnTimeout overrides the timeout response. By default lightmux.Error is called with
+	// 503 and http.ErrHandlerTimeout, so the central error encoder renders the body.
+	OnTimeout http.HandlerFunc
+}
+
+// Timeout returns a middleware equivalent to http.TimeoutHandler: the handler runs with a context
+// cancelled after cfg.Timeout and its response is buffered; when the timeout fires first,
+// the buffered response is discarded and the timeout response is written instead.
+// Later writes of the handler return http.ErrHandlerTimeout. Apply it per group for different timeouts.
+func Timeout(cfg TimeoutConfig) Middleware {
+	if cfg.Timeout <= 0 {
+		panic("timeout must be positive")
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), cfg.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				next(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+				for key, values := range tw.header {
+					dst[key] = values
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+				if cfg.OnTimeout != nil {
+					cfg.OnTimeout(w, r)
+					return
+				}
+				Error(w, r, http.StatusServiceUnavailable, http.ErrHandlerTimeout)
+			}
+		}
+	}
+}
+
+// timeoutWriter buffers the handler response until it completes or times out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
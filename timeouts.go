@@ -0,0 +1,49 @@
+package lightmux
+
+import "time"
+
+// Default server timeouts applied by Run, RunTLS and Start to zero http.Server fields, see SetDefaultTimeouts.
+// WriteTimeout is left unset since it would cut off streaming responses and long downloads;
+// bound handlers with the Timeout middleware instead.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+)
+
+// SetDefaultTimeouts controls whether zero ReadHeaderTimeout, ReadTimeout and IdleTimeout of the server
+// are replaced with safe defaults when it starts, protecting against slowloris-style resource exhaustion.
+// Enabled by default; timeouts set explicitly are never changed.
+func (l *LightMux) SetDefaultTimeouts(enabled bool) {
+	l.noDefaultTimeouts = !enabled
+}
+
+// WithDefaultTimeouts enables the default server timeouts, see SetDefaultTimeouts.
+func WithDefaultTimeouts() Option {
+	return func(l *LightMux) {
+		l.SetDefaultTimeouts(true)
+	}
+}
+
+// WithoutDefaultTimeouts disables the default server timeouts, see SetDefaultTimeouts.
+func WithoutDefaultTimeouts() Option {
+	return func(l *LightMux) {
+		l.SetDefaultTimeouts(false)
+	}
+}
+
+// applyDefaultTimeouts fills the zero server timeouts unless disabled.
+func (l *LightMux) applyDefaultTimeouts() {
+	if l.noDefaultTimeouts {
+		return
+	}
+	if l.server.ReadHeaderTimeout == 0 {
+		l.server.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if l.server.ReadTimeout == 0 {
+		l.server.ReadTimeout = DefaultReadTimeout
+	}
+	if l.server.IdleTimeout == 0 {
+		l.server.IdleTimeout = DefaultIdleTimeout
+	}
+}
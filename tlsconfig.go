@@ -0,0 +1,164 @@
+package lightmux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// RunTLSConfig starts the server with TLS configured by cfg instead of certificate files, e.g. certificates
+// loaded from memory or a secret store, or hot-reloaded through cfg.GetCertificate (see ReloadableCertificate).
+// cfg must provide Certificates, GetCertificate or GetConfigForClient. Otherwise it behaves like RunTLS.
+func (l *LightMux) RunTLSConfig(ctx context.Context, cfg *tls.Config) error {
+	if cfg == nil || (len(cfg.Certificates) == 0 && cfg.GetCertificate == nil && cfg.GetConfigForClient == nil) {
+		return errors.New("lightmux: TLS config has no certificates")
+	}
+	l.server.TLSConfig = cfg
+	l.addHTTPSRedirectListener()
+
+	return l.serve(ctx, ":https", func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, "", "")
+	})
+}
+
+// ReloadableCertificate holds a TLS certificate that can be replaced while the server runs,
+// e.g. from an OnReload hook re-reading a secret store. Use its GetCertificate in tls.Config.
+type ReloadableCertificate struct {
+	cert Reloadable[*tls.Certificate]
+
+	// certFile and keyFile are set by LoadCertificateFiles, modTimes holds their modification times when last
+	// reloaded, even if that failed, so a broken change is reported once.
+	mu                sync.Mutex
+	certFile, keyFile string
+	modTimes          [2]time.Time
+}
+
+// NewReloadableCertificate creates a ReloadableCertificate from a PEM encoded certificate chain and key.
+func NewReloadableCertificate(certPEM, keyPEM []byte) (*ReloadableCertificate, error) {
+	c := &ReloadableCertificate{}
+	if err := c.Update(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update parses a PEM encoded certificate chain and key and replaces the current certificate.
+// The current certificate is kept if they are invalid.
+func (c *ReloadableCertificate) Update(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+// Store replaces the current certificate.
+func (c *ReloadableCertificate) Store(cert *tls.Certificate) {
+	c.cert.Store(cert)
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate.
+func (c *ReloadableCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := c.cert.Load()
+	if cert == nil {
+		return nil, errors.New("lightmux: no TLS certificate loaded")
+	}
+	return cert, nil
+}
+
+// LoadCertificateFiles creates a ReloadableCertificate from PEM files, reloadable with ReloadFiles.
+func LoadCertificateFiles(certFile, keyFile string) (*ReloadableCertificate, error) {
+	c := &ReloadableCertificate{certFile: certFile, keyFile: keyFile}
+	if err := c.ReloadFiles(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ReloadFiles reloads the certificate from the files it was loaded from with LoadCertificateFiles.
+// The current certificate is kept if they are invalid.
+func (c *ReloadableCertificate) ReloadFiles() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.certFile == "" {
+		return errors.New("lightmux: certificate was not loaded from files")
+	}
+
+	c.modTimes = certModTimes(c.certFile, c.keyFile)
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+// filesChanged reports whether the certificate files changed since they were last reloaded.
+func (c *ReloadableCertificate) filesChanged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return certModTimes(c.certFile, c.keyFile) != c.modTimes
+}
+
+func certModTimes(certFile, keyFile string) [2]time.Time {
+	var modTimes [2]time.Time
+	for i, file := range []string{certFile, keyFile} {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// SetCertWatchInterval makes RunTLS check its certificate files for changes every interval
+// and reload them without restart, e.g. after renewal by certbot or a secret sidecar. Zero disables watching.
+func (l *LightMux) SetCertWatchInterval(interval time.Duration) {
+	l.certWatchInterval = interval
+}
+
+// reloadableCertFiles loads the RunTLS certificate files, reloading them on Reload and, if enabled, on change.
+func (l *LightMux) reloadableCertFiles(certFile, keyFile string) (*ReloadableCertificate, error) {
+	cert, err := LoadCertificateFiles(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	l.reload.mu.Lock()
+	l.reload.hooks = append(l.reload.hooks, cert.ReloadFiles)
+	l.reload.mu.Unlock()
+
+	if l.certWatchInterval > 0 {
+		stop := make(chan struct{})
+		l.onStart(func() {
+			go func() {
+				ticker := time.NewTicker(l.certWatchInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if !cert.filesChanged() {
+							continue
+						}
+						if err := cert.ReloadFiles(); err != nil {
+							l.logger.Error("reloading TLS certificate", "error", err)
+						} else {
+							l.logger.Info("TLS certificate reloaded.")
+						}
+					case <-stop:
+						return
+					}
+				}
+			}()
+		})
+		l.onStop(func(context.Context) error {
+			close(stop)
+			return nil
+		})
+	}
+	return cert, nil
+}
@@ -0,0 +1,79 @@
+package lightmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TLSFallbackMode selects what RunTLS does when the certificate or key file is missing at startup.
+type TLSFallbackMode int
+
+const (
+	// TLSFallbackNone fails startup with the TLS error (default).
+	TLSFallbackNone TLSFallbackMode = iota
+	// TLSFallbackHTTP starts in degraded HTTP-only mode on the same address.
+	TLSFallbackHTTP
+	// TLSFallbackWait waits for the files to appear (e.g. provisioned by a sidecar) and then starts TLS.
+	TLSFallbackWait
+)
+
+// TLSFallback configures RunTLS behavior for missing certificate files.
+type TLSFallback struct {
+	Mode TLSFallbackMode
+	// PollInterval between file checks in TLSFallbackWait mode, default: 2 seconds.
+	PollInterval time.Duration
+	// Timeout of TLSFallbackWait mode, zero waits until the context is cancelled.
+	Timeout time.Duration
+}
+
+// SetTLSFallback configures how RunTLS handles missing certificate or key files.
+func (l *LightMux) SetTLSFallback(fallback TLSFallback) {
+	if fallback.PollInterval <= 0 {
+		fallback.PollInterval = 2 * time.Second
+	}
+	l.tlsFallback = fallback
+}
+
+// missingTLSFiles returns the names of files that do not exist.
+func missingTLSFiles(files ...string) []string {
+	var missing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, file)
+		}
+	}
+	return missing
+}
+
+// waitTLSFiles polls until all files exist. It returns ctx.Err() when ctx is cancelled
+// and an error when the fallback timeout expires.
+func (l *LightMux) waitTLSFiles(ctx context.Context, files ...string) error {
+	if l.tlsFallback.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.tlsFallback.Timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(l.tlsFallback.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		missing := missingTLSFiles(files...)
+		if len(missing) == 0 {
+			l.logger.Info("TLS files are available, starting TLS")
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("lightmux: TLS files %v still missing after %s", missing, l.tlsFallback.Timeout)
+			}
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package lightmux
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// TLSConnInfo describes the TLS connection a request arrived on, see TLSInfo.
+type TLSConnInfo struct {
+	// Version and VersionName of the negotiated protocol, e.g. tls.VersionTLS13 and "TLS 1.3".
+	Version     uint16
+	VersionName string
+	// CipherSuite and CipherSuiteName of the negotiated cipher suite.
+	CipherSuite     uint16
+	CipherSuiteName string
+	// NegotiatedProtocol is the ALPN protocol (e.g. "h2"), empty if none was negotiated.
+	NegotiatedProtocol string
+	// ServerName is the SNI name requested by the client.
+	ServerName string
+	// DidResume reports whether the session was resumed.
+	DidResume bool
+	// PeerCertificates are the client certificates, leaf first. Empty without mutual TLS.
+	PeerCertificates []*x509.Certificate
+	// VerifiedChains are the chains verified against the configured client CAs, if verification was requested.
+	VerifiedChains [][]*x509.Certificate
+}
+
+// TLSInfo returns the TLS connection details of the request, or nil if the request was not served over TLS.
+func TLSInfo(r *http.Request) *TLSConnInfo {
+	if r.TLS == nil {
+		return nil
+	}
+	state := r.TLS
+	return &TLSConnInfo{
+		Version:            state.Version,
+		VersionName:        tls.VersionName(state.Version),
+		CipherSuite:        state.CipherSuite,
+		CipherSuiteName:    tls.CipherSuiteName(state.CipherSuite),
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		ServerName:         state.ServerName,
+		DidResume:          state.DidResume,
+		PeerCertificates:   state.PeerCertificates,
+		VerifiedChains:     state.VerifiedChains,
+	}
+}
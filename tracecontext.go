@@ -0,0 +1,167 @@
+package lightmux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultTraceIDHeader is the response header carrying the trace ID, see TraceContextMiddleware.
+const DefaultTraceIDHeader = "X-Trace-ID"
+
+// maxTraceStateMembers is the maximum number of tracestate list members, longer states are dropped.
+const maxTraceStateMembers = 32
+
+type traceCtxKey struct{}
+
+// TraceContext is the W3C Trace Context (traceparent and tracestate) of a request.
+type TraceContext struct {
+	// TraceID is 32 lowercase hex characters, shared by all spans of the trace.
+	TraceID string
+	// SpanID is 16 lowercase hex characters identifying the server span of this request.
+	SpanID string
+	// ParentID is the span ID of the caller, empty if the trace started here.
+	ParentID string
+	// Flags holds the trace flags, bit 0 is "sampled".
+	Flags byte
+	// State is the vendor-specific tracestate header, passed through unchanged.
+	State string
+}
+
+// Sampled reports whether the caller recorded the trace.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 != 0
+}
+
+// Traceparent formats the traceparent header value of the span, e.g. for outgoing requests.
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// TraceContextConfig configures the TraceContextMiddleware.
+type TraceContextConfig struct {
+	// Header echoing the trace ID in responses, default: X-Trace-ID.
+	Header string
+	// Sampled sets the sampled flag of traces started here. Incoming flags are kept.
+	Sampled bool
+}
+
+// TraceContextMiddleware returns a middleware parsing the W3C traceparent and tracestate headers
+// or starting a new trace when they are missing or invalid. Every request gets a new span ID with the
+// incoming span as parent. The trace is stored in the request context (see TraceContextFrom and TraceID),
+// the trace ID is echoed in the response header, and RequestLogger and LoggerFrom log it as trace_id
+// without a full OpenTelemetry setup.
+func TraceContextMiddleware(cfg TraceContextConfig) Middleware {
+	if cfg.Header == "" {
+		cfg.Header = DefaultTraceIDHeader
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			tc, ok := ParseTraceparent(r.Header.Get("traceparent"))
+			if ok {
+				tc.ParentID = tc.SpanID
+				tc.State = parseTracestate(r.Header.Values("tracestate"))
+			} else {
+				tc = TraceContext{TraceID: randomHex(16)}
+				if cfg.Sampled {
+					tc.Flags = 0x01
+				}
+			}
+			tc.SpanID = randomHex(8)
+
+			if info := requestInfoFrom(r.Context()); info != nil {
+				info.trace = &tc
+			}
+			w.Header().Set(cfg.Header, tc.TraceID)
+
+			next(w, r.WithContext(context.WithValue(r.Context(), traceCtxKey{}, tc)))
+		}
+	}
+}
+
+// TraceContextFrom returns the trace of the request, ok is false outside of TraceContextMiddleware.
+func TraceContextFrom(r *http.Request) (tc TraceContext, ok bool) {
+	if tc, ok := r.Context().Value(traceCtxKey{}).(TraceContext); ok {
+		return tc, true
+	}
+	if info := requestInfoFrom(r.Context()); info != nil && info.trace != nil {
+		return *info.trace, true
+	}
+	return TraceContext{}, false
+}
+
+// TraceID returns the trace ID of the request, or an empty string.
+func TraceID(r *http.Request) string {
+	tc, _ := TraceContextFrom(r)
+	return tc.TraceID
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers of an outgoing request made while serving r,
+// so the downstream service continues the trace with the span of r as parent.
+func InjectTraceContext(r *http.Request, out http.Header) {
+	tc, ok := TraceContextFrom(r)
+	if !ok {
+		return
+	}
+	out.Set("traceparent", tc.Traceparent())
+	if tc.State != "" {
+		out.Set("tracestate", tc.State)
+	}
+}
+
+// ParseTraceparent parses a W3C traceparent header value. The returned SpanID is the caller's span.
+// Invalid values, all-zero IDs and the forbidden version ff are rejected.
+func ParseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isLowerHex(parts[0]) {
+		return TraceContext{}, false
+	}
+	// version 00 has exactly four fields, future versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return TraceContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isLowerHex(traceID) || strings.Trim(traceID, "0") == "" ||
+		len(spanID) != 16 || !isLowerHex(spanID) || strings.Trim(spanID, "0") == "" ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return TraceContext{}, false
+	}
+
+	b, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: b[0]}, true
+}
+
+// parseTracestate joins the tracestate header lines, dropping the state if it has too many members.
+func parseTracestate(values []string) string {
+	var members []string
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members = append(members, member)
+			}
+		}
+	}
+	if len(members) > maxTraceStateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,123 @@
+package lightmux
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrBeginTx is passed to Error, wrapping the Beginner error, when the Transaction middleware fails to begin.
+var ErrBeginTx = errors.New("failed to begin transaction")
+
+// Tx is a request-scoped transaction. *sql.Tx satisfies it.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Beginner begins transactions for the Transaction middleware.
+type Beginner interface {
+	BeginTx(ctx context.Context) (Tx, error)
+}
+
+// BeginnerFunc adapts a function to the Beginner interface.
+type BeginnerFunc func(ctx context.Context) (Tx, error)
+
+// BeginTx calls f(ctx).
+func (f BeginnerFunc) BeginTx(ctx context.Context) (Tx, error) {
+	return f(ctx)
+}
+
+// SQLBeginner returns a Beginner starting transactions on db with the given options.
+func SQLBeginner(db *sql.DB, opts *sql.TxOptions) Beginner {
+	return BeginnerFunc(func(ctx context.Context) (Tx, error) {
+		return db.BeginTx(ctx, opts)
+	})
+}
+
+type txCtxKey struct{}
+
+// txState is stored in the request context by the Transaction middleware.
+type txState struct {
+	tx Tx
+
+	mu  sync.Mutex
+	err error
+}
+
+// Transaction returns a middleware that begins a transaction per request and stores it in the request context.
+// The transaction is committed when the handler responds with a status below 400 and did not call AbortTx,
+// otherwise (including panics) it is rolled back. Commit and rollback errors are logged through the Logger
+// of the LightMux (see WithLogger), as the response has already been written at that point.
+func Transaction(b Beginner) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			tx, err := b.BeginTx(r.Context())
+			if err != nil {
+				requestLogger(r).Error("begin transaction", "method", r.Method, "path", r.URL.Path, "error", err)
+				Error(w, r, http.StatusInternalServerError, fmt.Errorf("%w: %w", ErrBeginTx, err))
+				return
+			}
+
+			state := &txState{tx: tx}
+			rec := newResponseRecorder(w)
+
+			defer func() {
+				if p := recover(); p != nil {
+					if err := tx.Rollback(); err != nil {
+						requestLogger(r).Error("rollback transaction", "method", r.Method, "path", r.URL.Path, "error", err)
+					}
+					panic(p)
+				}
+
+				if state.failed() || rec.Status() >= http.StatusBadRequest {
+					if err := tx.Rollback(); err != nil {
+						requestLogger(r).Error("rollback transaction", "method", r.Method, "path", r.URL.Path, "error", err)
+					}
+					return
+				}
+
+				if err := tx.Commit(); err != nil {
+					requestLogger(r).Error("commit transaction", "method", r.Method, "path", r.URL.Path, "error", err)
+				}
+			}()
+
+			next(rec, r.WithContext(context.WithValue(r.Context(), txCtxKey{}, state)))
+		}
+	}
+}
+
+// RequestTx returns the transaction started by the Transaction middleware, or nil if there is none.
+func RequestTx(r *http.Request) Tx {
+	if state, ok := r.Context().Value(txCtxKey{}).(*txState); ok {
+		return state.tx
+	}
+	return nil
+}
+
+// AbortTx marks the request transaction for rollback regardless of the response status.
+// It reports whether the request has a transaction.
+func AbortTx(r *http.Request, err error) bool {
+	state, ok := r.Context().Value(txCtxKey{}).(*txState)
+	if !ok {
+		return false
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if err == nil {
+		err = context.Canceled
+	}
+	state.err = err
+	return true
+}
+
+func (s *txState) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err != nil
+}
@@ -1,9 +1,13 @@
 package lightmux
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 )
 
@@ -29,6 +33,34 @@ func allowedMethodsJoin(mp map[string]http.Handler) string {
 	for method := range mp {
 		methods = append(methods, method)
 	}
-	
+	sort.Strings(methods)
+
 	return strings.Join(methods, ", ")
-}
\ No newline at end of file
+}
+
+// writeJSONError writes a {"error": msg} JSON body with the given status code.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": msg,
+	})
+}
+
+// newID returns a random 128-bit hex encoded identifier.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// matchOrigin reports whether origin matches pattern, either exactly (case-insensitive)
+// or through a single "*" wildcard such as "https://*.example.com".
+func matchOrigin(pattern, origin string) bool {
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	return ok && len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
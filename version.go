@@ -0,0 +1,81 @@
+package lightmux
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deprecation describes the deprecation state of an API version.
+type Deprecation struct {
+	// Date is the moment the version was deprecated, sent as "Deprecation: @<unix-seconds>".
+	// Zero value uses the time DeprecateVersion is called.
+	Date time.Time
+	// Sunset is the moment the version stops being served. Zero value omits the Sunset header.
+	Sunset time.Time
+	// Link is an optional URL documenting the deprecation, sent as Link with rel="deprecation".
+	Link string
+}
+
+// VersionGroup creates a RouteGroup prefixed with the given API version (e.g. "v1" -> "/v1").
+// Every route created in the group, or in groups continued from it, records the version in Route.Version.
+func (l *LightMux) VersionGroup(version string, middlewares ...Middleware) *RouteGroup {
+	version = strings.Trim(version, "/")
+	if version == "" {
+		panic("empty API version")
+	}
+
+	if _, exists := l.versions[version]; !exists {
+		l.versions[version] = nil
+	}
+
+	group := l.NewGroup("/"+version, middlewares...)
+	group.version = version
+	return group
+}
+
+// DeprecateVersion marks an API version as deprecated.
+// Routes of that version will respond with Deprecation, Sunset and Link headers (RFC 9745, RFC 8594).
+// It must be called before Run, as the headers are resolved when routes are applied.
+func (l *LightMux) DeprecateVersion(version string, deprecation Deprecation) {
+	version = strings.Trim(version, "/")
+	if _, exists := l.versions[version]; !exists {
+		panic("unknown API version: " + version)
+	}
+
+	if deprecation.Date.IsZero() {
+		deprecation.Date = time.Now()
+	}
+	l.versions[version] = &deprecation
+}
+
+// VersionRoutes returns all routes that belong to the given API version, sorted by path.
+func (l *LightMux) VersionRoutes(version string) []*Route {
+	version = strings.Trim(version, "/")
+
+	var routes []*Route
+	for _, route := range l.routeMap {
+		if route.Version == version {
+			routes = append(routes, route)
+		}
+	}
+	slices.SortFunc(routes, func(a, b *Route) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return routes
+}
+
+// setHeaders writes the deprecation headers into h.
+func (d *Deprecation) setHeaders(h http.Header) {
+	h.Set("Deprecation", "@"+strconv.FormatInt(d.Date.Unix(), 10))
+
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+
+	if d.Link != "" {
+		h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+}
@@ -0,0 +1,328 @@
+package lightmux
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWebhookQueueFull is returned by WebhookDispatcher.Send when the delivery queue is full.
+	ErrWebhookQueueFull = errors.New("webhook queue is full")
+	// ErrWebhookDispatcherClosed is returned by WebhookDispatcher.Send after the dispatcher was stopped.
+	ErrWebhookDispatcherClosed = errors.New("webhook dispatcher is closed")
+)
+
+// Webhook is a single outbound webhook to deliver.
+type Webhook struct {
+	URL     string
+	Event   string      // sent as X-Webhook-Event
+	Payload []byte      // sent as request body
+	Header  http.Header // optional extra headers
+}
+
+// WebhookDelivery is a delivery log entry, recorded for every delivery attempt.
+type WebhookDelivery struct {
+	ID       string // webhook ID, same for all attempts, sent as X-Webhook-ID
+	URL      string
+	Event    string
+	Attempt  int
+	Status   int // response status, 0 if the request failed
+	Err      error
+	Time     time.Time
+	Duration time.Duration
+}
+
+// WebhookConfig configures a WebhookDispatcher. Zero values fall back to defaults.
+type WebhookConfig struct {
+	Client *http.Client // default: client with 10 second timeout
+
+	// Secret signs payloads with HMAC-SHA256 over "timestamp.payload".
+	// The signature is sent as "sha256=<hex>" in SignatureHeader (default: X-Webhook-Signature)
+	// and the unix timestamp in X-Webhook-Timestamp. Empty secret disables signing.
+	Secret          []byte
+	SignatureHeader string
+
+	Workers     int           // default: 4
+	QueueSize   int           // default: 1024
+	MaxAttempts int           // default: 5
+	BaseBackoff time.Duration // default: 1 second, doubled after every failed attempt
+	MaxBackoff  time.Duration // default: 1 minute
+	LogSize     int           // number of recent deliveries kept for Deliveries, default: 100
+
+	// OnDelivery is called after every delivery attempt.
+	OnDelivery func(WebhookDelivery)
+}
+
+// WebhookDispatcher delivers webhooks from a queue with retries, exponential backoff and HMAC signing.
+type WebhookDispatcher struct {
+	cfg   WebhookConfig
+	queue chan webhookJob
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	log     []WebhookDelivery
+}
+
+type webhookJob struct {
+	id   string
+	hook Webhook
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher, call Start to begin delivering.
+func NewWebhookDispatcher(cfg WebhookConfig) *WebhookDispatcher {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = "X-Webhook-Signature"
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.LogSize <= 0 {
+		cfg.LogSize = 100
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		cfg:    cfg,
+		queue:  make(chan webhookJob, cfg.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Webhooks creates a WebhookDispatcher bound to the server lifecycle:
+// it starts delivering when Run starts and drains the queue during graceful shutdown.
+func (l *LightMux) Webhooks(cfg WebhookConfig) *WebhookDispatcher {
+	d := NewWebhookDispatcher(cfg)
+	l.onStart(d.Start)
+	l.onStop(d.Stop)
+	return d
+}
+
+// Start launches the delivery workers. Calling Start more than once has no effect.
+func (d *WebhookDispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started || d.closed {
+		return
+	}
+	d.started = true
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Send enqueues a webhook and returns its ID. It does not block when the queue is full.
+func (d *WebhookDispatcher) Send(hook Webhook) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return "", ErrWebhookDispatcherClosed
+	}
+
+	job := webhookJob{id: newID(), hook: hook}
+	select {
+	case d.queue <- job:
+		return job.id, nil
+	default:
+		return "", ErrWebhookQueueFull
+	}
+}
+
+// Stop stops accepting webhooks and waits for queued ones to be delivered.
+// When ctx is done first, pending deliveries and retries are abandoned and ctx.Err() is returned.
+func (d *WebhookDispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	started := d.started
+	d.mu.Unlock()
+
+	if !started {
+		d.cancel()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Deliveries returns the most recent delivery attempts, oldest first.
+func (d *WebhookDispatcher) Deliveries() []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]WebhookDelivery, len(d.log))
+	copy(deliveries, d.log)
+	return deliveries
+}
+
+func (d *WebhookDispatcher) worker() {
+	defer d.wg.Done()
+
+	for job := range d.queue {
+		d.deliver(job)
+	}
+}
+
+// deliver attempts delivery of job until it succeeds, fails permanently or attempts are exhausted.
+func (d *WebhookDispatcher) deliver(job webhookJob) {
+	backoff := d.cfg.BaseBackoff
+
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		delivery := d.attempt(job, attempt)
+		d.record(delivery)
+
+		if !retryableDelivery(delivery) || attempt == d.cfg.MaxAttempts {
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		backoff = min(backoff*2, d.cfg.MaxBackoff)
+	}
+}
+
+func (d *WebhookDispatcher) attempt(job webhookJob, attempt int) (delivery WebhookDelivery) {
+	delivery = WebhookDelivery{
+		ID:      job.id,
+		URL:     job.hook.URL,
+		Event:   job.hook.Event,
+		Attempt: attempt,
+		Time:    time.Now(),
+	}
+	defer func() {
+		delivery.Duration = time.Since(delivery.Time)
+	}()
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, job.hook.URL, bytes.NewReader(job.hook.Payload))
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+
+	for key, values := range job.hook.Header {
+		req.Header[key] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Webhook-ID", job.id)
+	if job.hook.Event != "" {
+		req.Header.Set("X-Webhook-Event", job.hook.Event)
+	}
+	if len(d.cfg.Secret) > 0 {
+		timestamp := strconv.FormatInt(delivery.Time.Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set(d.cfg.SignatureHeader, "sha256="+SignWebhook(d.cfg.Secret, timestamp, job.hook.Payload))
+	}
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+	resp.Body.Close()
+
+	delivery.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.Err = fmt.Errorf("webhook endpoint responded with status %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+func (d *WebhookDispatcher) record(delivery WebhookDelivery) {
+	if d.cfg.OnDelivery != nil {
+		d.cfg.OnDelivery(delivery)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.log) == d.cfg.LogSize {
+		copy(d.log, d.log[1:])
+		d.log = d.log[:len(d.log)-1]
+	}
+	d.log = append(d.log, delivery)
+}
+
+// retryableDelivery reports whether a failed delivery should be retried:
+// network errors, 408, 429 and 5xx responses are retried, other client errors are not.
+func retryableDelivery(delivery WebhookDelivery) bool {
+	if delivery.Err == nil {
+		return false
+	}
+	switch {
+	case delivery.Status == 0:
+		return true
+	case delivery.Status == http.StatusRequestTimeout, delivery.Status == http.StatusTooManyRequests:
+		return true
+	default:
+		return delivery.Status >= 500
+	}
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "timestamp.payload" using secret.
+// Receivers can use it to verify the X-Webhook-Signature header.
+func SignWebhook(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
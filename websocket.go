@@ -0,0 +1,75 @@
+package lightmux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrOriginNotAllowed is passed to Error when WebSocketOrigin rejects a handshake, wrapped with the Origin.
+var ErrOriginNotAllowed = errors.New("websocket origin not allowed")
+
+// OriginPolicy decides whether a WebSocket handshake with the given Origin may proceed.
+// Requests without an Origin header come from non-browser clients and are not passed to the policy.
+type OriginPolicy func(origin string, r *http.Request) bool
+
+// SameOrigin allows handshakes whose Origin host equals the request Host.
+func SameOrigin() OriginPolicy {
+	return func(origin string, r *http.Request) bool {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// AllowOrigins allows handshakes from the listed origins; "*" allows any origin
+// and entries like "https://*.example.com" allow any subdomain.
+func AllowOrigins(origins ...string) OriginPolicy {
+	return func(origin string, r *http.Request) bool {
+		for _, allowed := range origins {
+			if allowed == "*" || matchOrigin(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WebSocketOrigin returns a route middleware validating the Origin of WebSocket upgrade requests
+// against policy before the handler performs the upgrade. Mismatches are answered with 403 through Error,
+// requests that are not WebSocket upgrades pass through untouched.
+func WebSocketOrigin(policy OriginPolicy) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !isWebSocketUpgrade(r) {
+				next(w, r)
+				return
+			}
+
+			if origin := r.Header.Get("Origin"); origin != "" && !policy(origin, r) {
+				Error(w, r, http.StatusForbidden, fmt.Errorf("%w: %s", ErrOriginNotAllowed, origin))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// isWebSocketUpgrade reports whether r asks for a WebSocket upgrade.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerContainsToken reports whether the comma separated header values contain token (case-insensitive).
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package lightmux
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RobotsRule is a group of robots.txt directives for one user agent.
+type RobotsRule struct {
+	UserAgent  string // default: "*"
+	Allow      []string
+	Disallow   []string
+	CrawlDelay int // seconds, zero omits the directive
+}
+
+// RobotsPolicy describes the robots.txt served by LightMux.Robots.
+type RobotsPolicy struct {
+	Rules    []RobotsRule
+	Sitemaps []string
+	// MaxAge of the Cache-Control header, default: 24 hours.
+	MaxAge time.Duration
+}
+
+// AllowAllRobots returns a policy allowing every crawler everywhere.
+func AllowAllRobots() RobotsPolicy {
+	return RobotsPolicy{Rules: []RobotsRule{{UserAgent: "*", Disallow: []string{""}}}}
+}
+
+// DisallowAllRobots returns a policy asking every crawler to stay away, handy for staging and APIs.
+func DisallowAllRobots() RobotsPolicy {
+	return RobotsPolicy{Rules: []RobotsRule{{UserAgent: "*", Disallow: []string{"/"}}}}
+}
+
+// String renders the policy in robots.txt format.
+func (p RobotsPolicy) String() string {
+	var b strings.Builder
+	for i, rule := range p.Rules {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		ua := rule.UserAgent
+		if ua == "" {
+			ua = "*"
+		}
+		fmt.Fprintf(&b, "User-agent: %s\n", ua)
+		for _, path := range rule.Allow {
+			fmt.Fprintf(&b, "Allow: %s\n", path)
+		}
+		for _, path := range rule.Disallow {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+		}
+		if rule.CrawlDelay > 0 {
+			fmt.Fprintf(&b, "Crawl-delay: %d\n", rule.CrawlDelay)
+		}
+	}
+	if len(p.Sitemaps) > 0 {
+		b.WriteString("\n")
+		for _, sitemap := range p.Sitemaps {
+			fmt.Fprintf(&b, "Sitemap: %s\n", sitemap)
+		}
+	}
+	return b.String()
+}
+
+// Robots serves the policy on /robots.txt (GET and HEAD) with caching headers.
+func (l *LightMux) Robots(policy RobotsPolicy, middlewares ...Middleware) *Route {
+	if policy.MaxAge <= 0 {
+		policy.MaxAge = 24 * time.Hour
+	}
+	return l.staticRoute("/robots.txt", "robots.txt", []byte(policy.String()),
+		"text/plain; charset=utf-8", policy.MaxAge, middlewares)
+}
+
+// Favicon serves the file name from fsys on /favicon.ico (GET and HEAD) with caching headers and an ETag.
+// maxAge sets the Cache-Control max-age, zero uses 7 days. It panics if the file cannot be read.
+func (l *LightMux) Favicon(fsys fs.FS, name string, maxAge time.Duration, middlewares ...Middleware) *Route {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		panic(fmt.Sprintf("read favicon %s: %v", name, err))
+	}
+	if maxAge <= 0 {
+		maxAge = 7 * 24 * time.Hour
+	}
+
+	contentType := http.DetectContentType(data)
+	if strings.HasSuffix(name, ".svg") {
+		contentType = "image/svg+xml"
+	}
+	return l.staticRoute("/favicon.ico", name, data, contentType, maxAge, middlewares)
+}
+
+// staticRoute registers a route serving fixed content with Cache-Control and ETag headers.
+func (l *LightMux) staticRoute(path, name string, data []byte, contentType string, maxAge time.Duration, middlewares []Middleware) *Route {
+	etag := ETag(data)
+	cacheControl := "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+	modTime := time.Now()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", contentType)
+		h.Set("Cache-Control", cacheControl)
+		h.Set("ETag", etag)
+		http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+	}
+
+	route := l.NewRoute(path, middlewares...)
+	route.Handle(http.MethodGet, handler)
+	route.Handle(http.MethodHead, handler)
+	return route
+}
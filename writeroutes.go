@@ -0,0 +1,74 @@
+package lightmux
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RoutesFormat selects the output of WriteRoutes.
+type RoutesFormat int
+
+const (
+	// RoutesList writes every route with its methods, handlers and middlewares on separate lines (default).
+	RoutesList RoutesFormat = iota
+	// RoutesTable writes one aligned row per route and method.
+	RoutesTable
+	// RoutesCompact writes one line per route: its methods and path.
+	RoutesCompact
+)
+
+// WriteRoutes writes the registered routes sorted by path, with methods sorted too,
+// so the output can go to logs or files and be diffed between builds.
+func (l *LightMux) WriteRoutes(w io.Writer, format RoutesFormat) error {
+	routes := make([]*Route, 0, len(l.routeMap))
+	for _, route := range l.routeMap {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+
+	var b strings.Builder
+	switch format {
+	case RoutesTable:
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "METHOD\tPATH\tHANDLER\tMIDDLEWARES")
+		for _, route := range routes {
+			for _, method := range sortedMethods(route) {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", method, route.Path, getFuncName(route.Methods[method]), len(route.Middlewares))
+			}
+		}
+		tw.Flush()
+
+	case RoutesCompact:
+		for _, route := range routes {
+			fmt.Fprintf(&b, "%s %s\n", strings.Join(sortedMethods(route), ","), route.Path)
+		}
+
+	default:
+		fmt.Fprintf(&b, "Global middlewares: %d\n", len(l.globalMiddlewareStack))
+		for _, route := range routes {
+			fmt.Fprintf(&b, "Route: %s\n", route.Path)
+			for _, method := range sortedMethods(route) {
+				fmt.Fprintf(&b, "\t- %s (handler: %s)\n", method, getFuncName(route.Methods[method]))
+			}
+			fmt.Fprintf(&b, "\tMiddlewares: %d\n", len(route.Middlewares))
+			for i, mw := range route.Middlewares {
+				fmt.Fprintf(&b, "\t\t%d: %s\n", i+1, getFuncName(mw))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedMethods(route *Route) []string {
+	methods := make([]string, 0, len(route.Methods))
+	for method := range route.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}